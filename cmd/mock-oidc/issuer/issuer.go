@@ -0,0 +1,182 @@
+// Package issuer is the mock OpenID Connect issuer served by cmd/mock-oidc. It can also be
+// mounted on an httptest server to exercise the login flow from tests.
+package issuer
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	jwt "github.com/dgrijalva/jwt-go"
+	"log"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type authorization struct {
+	ClientId    string
+	RedirectUri string
+	Nonce       string
+	Challenge   string
+	Email       string
+	ExpiresAt   time.Time
+}
+
+// Issuer approves every authorization request and signs ID tokens for the login_hint address.
+// Url is the issuer url as seen by the API and may be set once the server address is known.
+type Issuer struct {
+	Url   string
+	key   *rsa.PrivateKey
+	mutex sync.Mutex
+	codes map[string]authorization
+}
+
+func New(issuerUrl string) (*Issuer, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Issuer{Url: issuerUrl, key: key, codes: map[string]authorization{}}, nil
+}
+
+func (s *Issuer) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.discovery)
+	mux.HandleFunc("/jwks", s.jwks)
+	mux.HandleFunc("/authorize", s.authorize)
+	mux.HandleFunc("/token", s.token)
+	return mux
+}
+
+func (s *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                s.Url,
+		"authorization_endpoint":                s.Url + "/authorize",
+		"token_endpoint":                        s.Url + "/token",
+		"jwks_uri":                              s.Url + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (s *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(s.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(s.key.E)).Bytes()),
+		}},
+	})
+}
+
+func (s *Issuer) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectUri, err := url.Parse(query.Get("redirect_uri"))
+	if err != nil || query.Get("redirect_uri") == "" {
+		http.Error(w, "redirect_uri is required", http.StatusBadRequest)
+		return
+	}
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+
+	email := query.Get("login_hint")
+	if email == "" {
+		email = "patient@example.com"
+	}
+
+	code := randomHex(16)
+	s.mutex.Lock()
+	s.codes[code] = authorization{
+		ClientId:    query.Get("client_id"),
+		RedirectUri: query.Get("redirect_uri"),
+		Nonce:       query.Get("nonce"),
+		Challenge:   query.Get("code_challenge"),
+		Email:       email,
+		ExpiresAt:   time.Now().Add(time.Minute),
+	}
+	s.mutex.Unlock()
+
+	values := redirectUri.Query()
+	values.Set("code", code)
+	values.Set("state", query.Get("state"))
+	redirectUri.RawQuery = values.Encode()
+	http.Redirect(w, r, redirectUri.String(), http.StatusFound)
+}
+
+func (s *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	s.mutex.Lock()
+	grant, ok := s.codes[r.PostForm.Get("code")]
+	delete(s.codes, r.PostForm.Get("code"))
+	s.mutex.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(grant.ExpiresAt):
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	case grant.RedirectUri != r.PostForm.Get("redirect_uri") || grant.ClientId != r.PostForm.Get("client_id"):
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "redirect_uri or client_id mismatch"})
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != grant.Challenge:
+		writeJson(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	now := time.Now()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":            s.Url,
+		"aud":            grant.ClientId,
+		"sub":            "mock|" + grant.Email,
+		"email":          grant.Email,
+		"email_verified": true,
+		"given_name":     "Mock",
+		"family_name":    "User",
+		"nonce":          grant.Nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	})
+	token.Header["kid"] = "mock"
+	idToken, err := token.SignedString(s.key)
+	if err != nil {
+		writeJson(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJson(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomHex(16),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idToken,
+	})
+}
+
+func writeJson(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func randomHex(n int) string {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		log.Fatal(err)
+	}
+	return hex.EncodeToString(buffer)
+}
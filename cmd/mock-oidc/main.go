@@ -0,0 +1,34 @@
+// Command mock-oidc is a minimal OpenID Connect issuer for local development and testing of
+// the social login flow. It approves every authorization request without a login screen and
+// signs ID tokens for the address passed as login_hint.
+//
+//	go run ./cmd/mock-oidc -addr :9000
+//
+// and configure the API with
+//
+//	OIDC_PROVIDERS=local
+//	OIDC_LOCAL_ISSUER=http://localhost:9000
+//	OIDC_LOCAL_CLIENT_ID=doctorrank
+//	OIDC_LOCAL_REDIRECT_URI=http://localhost:3000/oauth/local/callback
+package main
+
+import (
+	"doctorrank_go/cmd/mock-oidc/issuer"
+	"flag"
+	"log"
+	"net/http"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "address to listen on")
+	issuerUrl := flag.String("issuer", "http://localhost:9000", "issuer url as seen by the API")
+	flag.Parse()
+
+	server, err := issuer.New(*issuerUrl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Println("mock OIDC issuer listening on " + *addr)
+	log.Fatal(http.ListenAndServe(*addr, server.Handler()))
+}
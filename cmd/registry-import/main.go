@@ -0,0 +1,57 @@
+// Command registry-import loads a physician registry export into the registry_entries
+// collection and re-matches doctor applications and doctors against it.
+//
+//	go run ./cmd/registry-import -file registry.csv
+package main
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/controllers"
+	"doctorrank_go/helpers"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func main() {
+	path := flag.String("file", "", "registry file to import")
+	format := flag.String("format", "", "csv or json, taken from the file extension when empty")
+	flag.Parse()
+
+	if *path == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(*path), ".")
+	}
+
+	file, err := os.Open(*path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer file.Close()
+
+	entries, err := helpers.ParseRegistry(file, *format)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	configs.EnsureIndexes(configs.DB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+
+	result, err := controllers.ImportRegistryEntries(ctx, entries, filepath.Base(*path))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("inserted %d, updated %d registry entries\n", result.Inserted, result.Updated)
+	fmt.Printf("%d pending applications and %d doctors have registry matches\n", result.MatchedApplications, result.MatchedDoctors)
+}
@@ -19,6 +19,7 @@ var MAIL_SERVER_PORT = Env("MAIL_SERVER_PORT")
 var MAIL_SERVER_USERNAME = Env("MAIL_SERVER_USERNAME")
 var MAIL_SERVER_PASSWORD = Env("MAIL_SERVER_PASSWORD")
 var MAIL_SERVER_EMAIL_FROM = Env("MAIL_SERVER_EMAIL_FROM")
+var MFA_REQUIRED_FOR_DOCTORS = Env("MFA_REQUIRED_FOR_DOCTORS") == "true"
 
 func Env(key string) string {
 	err := godotenv.Load()
@@ -0,0 +1,159 @@
+package configs
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"time"
+)
+
+// UsernameCollation compares usernames case-insensitively. Queries on usernames, including the
+// sign-in lookups by email or username, pass it so that they are answered from the indexes
+// built with it.
+var UsernameCollation = &options.Collation{Locale: "en", Strength: 2}
+
+var indexes = map[string][]mongo.IndexModel{
+	"sessions": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "revoked_at", Value: 1}}},
+	},
+	"doctors": {
+		{Keys: bson.D{{Key: "rank", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ranks.bayesian", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ranks.wilson", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "ranks.recency", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "rating.value", Value: -1}, {Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}, {Key: "_id", Value: 1}}},
+		{Keys: bson.D{{Key: "profession_id", Value: 1}, {Key: "rank", Value: -1}}},
+		{Keys: bson.D{{Key: "hospital_id", Value: 1}, {Key: "rank", Value: -1}}},
+		{Keys: bson.D{{Key: "search_keys", Value: 1}}},
+	},
+	"hospitals": {
+		{Keys: bson.D{{Key: "search_keys", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	},
+	"professions": {
+		{Keys: bson.D{{Key: "search_keys", Value: 1}}},
+		{Keys: bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+	},
+	"comments": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"doctor_applications": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "status", Value: 1}}},
+		{Keys: bson.D{{Key: "status", Value: 1}, {Key: "created_at", Value: 1}}},
+	},
+	"registry_entries": {
+		{Keys: bson.D{{Key: "license_key", Value: 1}, {Key: "country", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "last_name_key", Value: 1}}},
+	},
+	"data_exports": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"users": {
+		{Keys: bson.D{{Key: "username", Value: 1}}, Options: options.Index().SetName("username_unique").SetUnique(true).SetCollation(UsernameCollation)},
+		{Keys: bson.D{{Key: "email", Value: 1}}, Options: options.Index().SetName("email_collated").SetCollation(UsernameCollation)},
+		{Keys: bson.D{{Key: "linked_identities.provider", Value: 1}, {Key: "linked_identities.subject", Value: 1}}},
+	},
+	"username_history": {
+		{Keys: bson.D{{Key: "username", Value: 1}, {Key: "released_at", Value: -1}}, Options: options.Index().SetName("username_released_at").SetCollation(UsernameCollation)},
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "changed_at", Value: -1}}},
+	},
+	"oauth_states": {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}},
+	},
+	"api_keys": {
+		{Keys: bson.D{{Key: "key_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+	},
+	"api_key_usage": {
+		{Keys: bson.D{{Key: "key_id", Value: 1}, {Key: "day", Value: -1}}},
+	},
+	"impersonations": {
+		{Keys: bson.D{{Key: "admin_id", Value: 1}, {Key: "created_at", Value: -1}}},
+	},
+	"audit_logs": {
+		{Keys: bson.D{{Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "actor_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "impersonation_id", Value: 1}, {Key: "created_at", Value: 1}}},
+	},
+	"consumed_tokens": {
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	},
+	"login_attempts": {
+		{Keys: bson.D{{Key: "locked_until", Value: -1}}},
+	},
+}
+
+func EnsureIndexes(client *mongo.Client) {
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	defer cancel()
+
+	// usernames used to be unique only with the same case, username_unique can not be built
+	// while such pairs are left
+	if err := renameDuplicateUsernames(ctx, client); err != nil {
+		log.Fatal(err)
+	}
+
+	for collectionName, models := range indexes {
+		if _, err := GetCollection(client, collectionName).Indexes().CreateMany(ctx, models); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println("MongoDB indexes ensured")
+}
+
+// renameDuplicateUsernames keeps the oldest account of every username that is only unique when
+// case matters and renames the others by appending part of their id
+func renameDuplicateUsernames(ctx context.Context, client *mongo.Client) error {
+	var duplicates []struct {
+		Users []struct {
+			Id       primitive.ObjectID `bson:"_id"`
+			Username string             `bson:"username"`
+		} `bson:"users"`
+	}
+
+	users := GetCollection(client, "users")
+	cursor, err := users.Aggregate(ctx, []bson.M{
+		{"$sort": bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}},
+		{"$group": bson.M{"_id": bson.M{"$toLower": "$username"}, "users": bson.M{"$push": bson.M{"_id": "$_id", "username": "$username"}}}},
+		{"$match": bson.M{"users.1": bson.M{"$exists": true}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &duplicates); err != nil {
+		return err
+	}
+
+	for _, duplicate := range duplicates {
+		for _, user := range duplicate.Users[1:] {
+			base := user.Username
+			if len(base) > 23 {
+				base = base[:23]
+			}
+			if base == "" {
+				base = "user"
+			}
+			username := base + "_" + user.Id.Hex()[18:]
+			count, err := users.CountDocuments(ctx, bson.M{"username": username}, options.Count().SetCollation(UsernameCollation))
+			if err != nil {
+				return err
+			}
+			if count > 0 {
+				username = "user_" + user.Id.Hex()
+			}
+
+			update := bson.M{"$set": bson.M{"username": username, "updated_at": time.Now().Unix()}}
+			if _, err = users.UpdateOne(ctx, bson.M{"_id": user.Id}, update); err != nil {
+				return err
+			}
+			log.Printf("renamed user %s from %q to %q, the username is taken with another case", user.Id.Hex(), user.Username, username)
+		}
+	}
+	return nil
+}
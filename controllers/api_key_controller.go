@@ -0,0 +1,139 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var apiKeyCollection *mongo.Collection = configs.GetCollection(configs.DB, "api_keys")
+var apiKeyUsageCollection *mongo.Collection = configs.GetCollection(configs.DB, "api_key_usage")
+
+func CreateApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.ApiKeyDTO
+		var apiKey models.ApiKey
+		defer cancel()
+
+		adminId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		for _, scope := range body.Scopes {
+			if !helpers.IsApiKeyScope(scope) {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "unknown scope " + scope + ", expected one of " + strings.Join(helpers.ApiKeyScopes, ", ")})
+				return
+			}
+		}
+
+		key, prefix := helpers.GenerateApiKey()
+		now := time.Now().Unix()
+
+		apiKey.Id = primitive.NewObjectID()
+		apiKey.Name = body.Name
+		apiKey.Prefix = prefix
+		apiKey.KeyHash = helpers.HashToken(key)
+		apiKey.Scopes = body.Scopes
+		apiKey.CreatedBy = adminId
+		apiKey.CreatedAt = now
+		if body.ExpiresInDays > 0 {
+			apiKey.ExpiresAt = now + body.ExpiresInDays*24*60*60
+		}
+
+		if _, err := apiKeyCollection.InsertOne(ctx, apiKey); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// the plain key is only ever shown in this response
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: dto.ApiKeyResDTO{Key: key, ApiKey: apiKey}})
+	}
+}
+
+func AllApiKeys() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var apiKeys []models.ApiKey
+		defer cancel()
+
+		cursor, err := apiKeyCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.M{"created_at": -1}))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &apiKeys); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: apiKeys})
+	}
+}
+
+func RevokeApiKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		keyId, _ := primitive.ObjectIDFromHex(c.Param("keyId"))
+
+		result, err := apiKeyCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": keyId, "revoked_at": 0},
+			bson.M{"$set": bson.M{"revoked_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.MatchedCount < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "api key not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: keyId})
+	}
+}
+
+func ApiKeyUsage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var usage []models.ApiKeyUsage
+		defer cancel()
+
+		keyId, _ := primitive.ObjectIDFromHex(c.Param("keyId"))
+
+		opts := options.Find().SetSort(bson.M{"day": -1}).SetLimit(90)
+		cursor, err := apiKeyUsageCollection.Find(ctx, bson.M{"key_id": keyId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &usage); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: usage})
+	}
+}
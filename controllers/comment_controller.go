@@ -45,12 +45,32 @@ func CreateOrUpdateComment() gin.HandlerFunc {
 		}
 
 		if count > 0 {
-			var comment bson.M
-			if err := c.BindJSON(&comment); err != nil {
+			var body bson.M
+			var existing models.Comment
+			if err := c.BindJSON(&body); err != nil {
 				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
 				return
 			}
-			comment["updated_at"] = time.Now().Unix()
+
+			// only text and rate can change, anything else would corrupt the doctor's rating
+			comment := bson.M{"updated_at": time.Now().Unix()}
+			if text, ok := body["text"].(string); ok {
+				comment["text"] = text
+			}
+			rate, hasRate := body["rate"].(float64)
+			if hasRate {
+				if validationErr := validate.Var(rate, "min=1,max=5"); validationErr != nil {
+					c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+					return
+				}
+				comment["rate"] = rate
+			}
+
+			if err := commentCollection.FindOne(ctx, bson.M{"user_id": userId, "doctor_id": doctorId}).Decode(&existing); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+
 			result, err := commentCollection.UpdateOne(
 				ctx,
 				bson.M{"user_id": userId, "doctor_id": doctorId},
@@ -61,6 +81,13 @@ func CreateOrUpdateComment() gin.HandlerFunc {
 				return
 			}
 
+			// a failed update leaves the rating stale until the next recompute
+			if hasRate && rate != existing.Rate {
+				if err = updateDoctorRating(ctx, doctorId, existing.Rate, existing.UpdatedAt, rate); err != nil {
+					log.Println(err)
+				}
+			}
+
 			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
 			return
 
@@ -90,6 +117,9 @@ func CreateOrUpdateComment() gin.HandlerFunc {
 				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
 				return
 			}
+			if err = updateDoctorRating(ctx, doctorId, 0, 0, comment.Rate); err != nil {
+				log.Println(err)
+			}
 			c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: comment})
 		}
 	}
@@ -121,7 +151,8 @@ func AllComments() gin.HandlerFunc {
 					"as":           "user",
 				},
 			},
-			{"$unwind": "$user"},
+			// comments of deleted accounts are kept for the ratings and shown under a placeholder
+			{"$unwind": bson.M{"path": "$user", "preserveNullAndEmptyArrays": true}},
 			{
 				"$project": bson.M{
 					"_id":             1,
@@ -136,8 +167,34 @@ func AllComments() gin.HandlerFunc {
 					"user.last_name":  1,
 					"user.username":   1,
 					"user.img":        1,
+					"user.privacy":    1,
+				},
+			},
+			{
+				"$addFields": bson.M{
+					"user": bson.M{"$ifNull": bson.A{"$user", bson.M{
+						"_id":        primitive.NilObjectID,
+						"first_name": "Deleted",
+						"last_name":  "user",
+						"username":   "deleted user",
+						"img":        "",
+						"deleted":    true,
+					}}},
 				},
 			},
+			{
+				"$addFields": bson.M{
+					"user": bson.M{"$cond": bson.A{"$user.privacy.use_pseudonym", bson.M{
+						"_id":        primitive.NilObjectID,
+						"first_name": "$user.privacy.pseudonym",
+						"last_name":  "",
+						"username":   "",
+						"img":        "",
+						"pseudonym":  true,
+					}, "$user"}},
+				},
+			},
+			{"$project": bson.M{"user.privacy": 0}},
 			{"$skip": skip},
 			{"$limit": limit},
 		}
@@ -213,3 +270,34 @@ func LikeOrDislikeComment() gin.HandlerFunc {
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
 	}
 }
+
+func DeleteComment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var comment models.Comment
+		defer cancel()
+
+		commentId, _ := primitive.ObjectIDFromHex(c.Param("comment_id"))
+
+		if err := commentCollection.FindOne(ctx, bson.M{"_id": commentId}).Decode(&comment); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "comment not found"})
+			return
+		}
+
+		result, err := commentCollection.DeleteOne(ctx, bson.M{"_id": commentId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.DeletedCount < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "comment not found"})
+			return
+		}
+
+		if err = updateDoctorRating(ctx, comment.DoctorId, comment.Rate, comment.UpdatedAt, 0); err != nil {
+			log.Println(err)
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+var dataExportCollection *mongo.Collection = configs.GetCollection(configs.DB, "data_exports")
+
+// exportCooldown keeps a user from queueing a new archive more than once per hour
+const exportCooldown = 60 * 60
+
+func RequestDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var export models.DataExport
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		now := time.Now().Unix()
+
+		// a pending export older than helpers.ExportBuildMinutes was abandoned and does not block
+		count, err := dataExportCollection.CountDocuments(ctx, bson.M{
+			"user_id": userId,
+			"$or": bson.A{
+				bson.M{"status": models.ExportPending, "created_at": bson.M{"$gt": now - 60*helpers.ExportBuildMinutes}},
+				bson.M{"created_at": bson.M{"$gt": now - exportCooldown}},
+			},
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusTooManyRequests, responses.Response{Status: http.StatusTooManyRequests, Message: "error", Data: "an export was requested recently, check your email"})
+			return
+		}
+
+		export.Id = primitive.NewObjectID()
+		export.UserId = userId
+		export.Status = models.ExportPending
+		export.CreatedAt = now
+
+		if _, err = dataExportCollection.InsertOne(ctx, export); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		go buildDataExport(export)
+
+		c.JSON(http.StatusAccepted, responses.Response{Status: http.StatusAccepted, Message: "success", Data: export})
+	}
+}
+
+func DownloadDataExport() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var export models.DataExport
+		defer cancel()
+
+		claims, msg := helpers.ValidateToken(c.Request.URL.Query().Get("exportToken"), helpers.ExportToken)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
+			return
+		}
+		if claims.ExportId != c.Param("exportId") {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "export not found or expired"})
+			return
+		}
+		userId, _ := primitive.ObjectIDFromHex(claims.Id)
+		exportId, _ := primitive.ObjectIDFromHex(claims.ExportId)
+
+		filter := bson.M{"_id": exportId, "user_id": userId, "status": models.ExportReady, "expires_at": bson.M{"$gt": time.Now().Unix()}}
+		if err := dataExportCollection.FindOne(ctx, filter).Decode(&export); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "export not found or expired"})
+			return
+		}
+
+		c.FileAttachment(helpers.ExportPath(export.File), "doctorrank-data.zip")
+	}
+}
+
+// ScheduleExportCleanup gives up on exports whose build never finished and deletes archives
+// whose download link has expired, right away and then every helpers.ExportCleanupMinutes
+func ScheduleExportCleanup() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if err := cleanUpDataExports(ctx); err != nil {
+			log.Println(err)
+		}
+		cancel()
+		time.Sleep(helpers.ExportCleanupMinutes * time.Minute)
+	}
+}
+
+func cleanUpDataExports(ctx context.Context) error {
+	var expired []models.DataExport
+	now := time.Now().Unix()
+
+	_, err := dataExportCollection.UpdateMany(
+		ctx,
+		bson.M{"status": models.ExportPending, "created_at": bson.M{"$lte": now - 60*helpers.ExportBuildMinutes}},
+		bson.M{"$set": bson.M{"status": models.ExportFailed, "error": "the export was not finished in time", "completed_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := dataExportCollection.Find(ctx, bson.M{"status": models.ExportReady, "expires_at": bson.M{"$lte": now}})
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &expired); err != nil {
+		return err
+	}
+
+	for _, export := range expired {
+		if err = os.Remove(helpers.ExportPath(export.File)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Println(err)
+			continue
+		}
+		_, err = dataExportCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": export.Id},
+			bson.M{"$set": bson.M{"status": models.ExportExpired, "file": ""}},
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// buildDataExport runs outside of the request, so it uses its own context and records the
+// outcome on the export document
+func buildDataExport(export models.DataExport) {
+	var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	user, err := writeDataExport(ctx, export)
+	now := time.Now().Unix()
+	update := bson.M{"status": models.ExportReady, "file": export.Id.Hex() + ".zip", "completed_at": now, "expires_at": now + 60*helpers.ExportLinkMinutes}
+	if err != nil {
+		log.Println(err)
+		update = bson.M{"status": models.ExportFailed, "error": err.Error(), "completed_at": now}
+	}
+
+	if _, err := dataExportCollection.UpdateOne(ctx, bson.M{"_id": export.Id}, bson.M{"$set": update}); err != nil {
+		log.Println(err)
+		return
+	}
+	if update["status"] != models.ExportReady {
+		return
+	}
+
+	exportToken, err := helpers.GenerateExportToken(export.UserId.Hex(), export.Id.Hex())
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	link := configs.CLIENT + "/export/" + export.Id.Hex() + "?exportToken=" + exportToken
+	if err = helpers.SendDataExportEmail(user.FirstName, user.Email, link); err != nil {
+		log.Println(err)
+	}
+}
+
+// writeDataExport collects everything stored about the user. Credentials are left out: the
+// password hash as well as the second factor secret and recovery codes.
+func writeDataExport(ctx context.Context, export models.DataExport) (models.User, error) {
+	var user models.User
+	var profile bson.M
+	var comments []bson.M
+	var likes []bson.M
+	var doctors []bson.M
+
+	if err := userCollection.FindOne(ctx, bson.M{"_id": export.UserId}).Decode(&user); err != nil {
+		return user, err
+	}
+
+	projection := bson.M{"password": 0, "mfa.secret": 0, "mfa.pending_secret": 0, "mfa.recovery_codes": 0, "mfa.last_used_step": 0, "activation_token_id": 0, "password_history": 0}
+	if err := userCollection.FindOne(ctx, bson.M{"_id": export.UserId}, options.FindOne().SetProjection(projection)).Decode(&profile); err != nil {
+		return user, err
+	}
+
+	// other users' likes on the user's comments are theirs, only the count is exported
+	cursor, err := commentCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"user_id": export.UserId}},
+		{"$addFields": bson.M{"likes_count": bson.M{"$size": bson.M{"$ifNull": bson.A{"$likes", bson.A{}}}}}},
+		{"$project": bson.M{"likes": 0}},
+	})
+	if err != nil {
+		return user, err
+	}
+	if err = cursor.All(ctx, &comments); err != nil {
+		return user, err
+	}
+
+	cursor, err = commentCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"likes.user_id": export.UserId}},
+		{"$unwind": "$likes"},
+		{"$match": bson.M{"likes.user_id": export.UserId}},
+		{"$project": bson.M{"_id": 0, "comment_id": "$_id", "doctor_id": 1, "status": "$likes.status"}},
+	})
+	if err != nil {
+		return user, err
+	}
+	if err = cursor.All(ctx, &likes); err != nil {
+		return user, err
+	}
+
+	cursor, err = doctorCollection.Find(ctx, bson.M{"user_id": export.UserId}, options.Find().SetProjection(bson.M{"registry_matches": 0}))
+	if err != nil {
+		return user, err
+	}
+	if err = cursor.All(ctx, &doctors); err != nil {
+		return user, err
+	}
+
+	documents := map[string]interface{}{
+		"user.json":     profile,
+		"comments.json": nonNil(comments),
+		"likes.json":    nonNil(likes),
+	}
+	path := configs.Env("FILESYSTEM_PATH")
+	files := map[string]string{}
+	if user.Img != "" {
+		files["user/avatar/"+user.Img] = filepath.Join(path, helpers.Folders.User, "avatar", filepath.Base(user.Img))
+		files["user/thumbnail/"+user.Img] = filepath.Join(path, helpers.Folders.User, "thumbnail", filepath.Base(user.Img))
+	}
+	if len(doctors) > 0 {
+		documents["doctor.json"] = doctors[0]
+		if img, ok := doctors[0]["img"].(string); ok && img != "" {
+			files["doctor/avatar/"+img] = filepath.Join(path, helpers.Folders.Doctor, "avatar", filepath.Base(img))
+			files["doctor/thumbnail/"+img] = filepath.Join(path, helpers.Folders.Doctor, "thumbnail", filepath.Base(img))
+		}
+	}
+
+	return user, helpers.WriteExportArchive(export.Id.Hex()+".zip", documents, files)
+}
+
+func nonNil(documents []bson.M) []bson.M {
+	if documents == nil {
+		return []bson.M{}
+	}
+	return documents
+}
@@ -0,0 +1,362 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var doctorApplicationCollection *mongo.Collection = configs.GetCollection(configs.DB, "doctor_applications")
+
+func CreateDoctorApplication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.DoctorApplicationDTO
+		var application models.DoctorApplication
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.Bind(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if c.GetString("role") != helpers.RoleUser {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "only regular users can apply to become a doctor"})
+			return
+		}
+
+		count, err := doctorApplicationCollection.CountDocuments(ctx, bson.M{"user_id": userId, "status": models.ApplicationPending})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "you already have a pending application"})
+			return
+		}
+
+		if body.DoctorId != "" {
+			doctorId, err := primitive.ObjectIDFromHex(body.DoctorId)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "invalid doctor id"})
+				return
+			}
+			count, err = doctorCollection.CountDocuments(ctx, bson.M{"_id": doctorId, "user_id": primitive.NilObjectID})
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			if count < 1 {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this doctor profile cannot be claimed"})
+				return
+			}
+			application.DoctorId = doctorId
+		}
+
+		application.Id = primitive.NewObjectID()
+		application.Documents = []string{}
+		for i, document := range body.Documents {
+			file, err := document.Open()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			buffer, err := io.ReadAll(io.LimitReader(file, helpers.MaxDocumentBytes+1))
+			file.Close()
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+
+			fileName, err := helpers.SaveDocument(buffer, application.Id.Hex()+"_"+strconv.Itoa(i), helpers.Folders.Doctor)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+				return
+			}
+			application.Documents = append(application.Documents, fileName)
+		}
+
+		application.UserId = userId
+		application.LicenseNumber = body.LicenseNumber
+		application.IssuingCountry = body.IssuingCountry
+		application.Status = models.ApplicationPending
+		application.CreatedAt = time.Now().Unix()
+		application.UpdatedAt = time.Now().Unix()
+
+		if _, err = doctorApplicationCollection.InsertOne(ctx, application); err != nil {
+			msg := fmt.Sprintf("Error creating doctor application")
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+			return
+		}
+
+		matchNewDoctorApplication(ctx, application)
+
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: application})
+	}
+}
+
+func DoctorApplicationsBySelf() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var applications []models.DoctorApplication
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		opts := options.Find().SetSort(bson.M{"created_at": -1})
+		cursor, err := doctorApplicationCollection.Find(ctx, bson.M{"user_id": userId}, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &applications); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: applications})
+	}
+}
+
+func AllDoctorApplications() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var applications []bson.M
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 20
+		}
+		status := queries.Get("status")
+		if status == "" {
+			status = models.ApplicationPending
+		}
+
+		pipeline := []bson.M{
+			{"$match": bson.M{"status": status}},
+			{"$sort": bson.M{"created_at": 1}},
+			{"$skip": skip},
+			{"$limit": limit},
+			{"$lookup": bson.M{
+				"from":         "users",
+				"localField":   "user_id",
+				"foreignField": "_id",
+				"as":           "user",
+			}},
+			{"$unwind": bson.M{"path": "$user", "preserveNullAndEmptyArrays": true}},
+			{"$project": bson.M{
+				"user.password": 0,
+				"user.mfa":      0,
+			}},
+		}
+		cursor, err := doctorApplicationCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &applications); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: applications})
+	}
+}
+
+func DoctorApplicationDocument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		applicationId, _ := primitive.ObjectIDFromHex(c.Param("applicationId"))
+		fileName := c.Param("fileName")
+
+		count, err := doctorApplicationCollection.CountDocuments(ctx, bson.M{"_id": applicationId, "documents": fileName})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "document not found"})
+			return
+		}
+
+		c.File(helpers.DocumentPath(helpers.Folders.Doctor, fileName))
+	}
+}
+
+func ApproveDoctorApplication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var application models.DoctorApplication
+		var user models.User
+		defer cancel()
+
+		applicationId, _ := primitive.ObjectIDFromHex(c.Param("applicationId"))
+		reviewerId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		// claiming the application first keeps two reviewers from approving it at once, it is
+		// reopened when the approval cannot be completed so that it can be retried
+		application, err := reviewDoctorApplication(ctx, applicationId, reviewerId, models.ApplicationApproved, "")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = userCollection.FindOne(ctx, bson.M{"_id": application.UserId}).Decode(&user); err != nil {
+			reopenDoctorApplication(ctx, application.Id)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// the profile before the role, a doctor is never left without one. Linking again after a
+		// failed attempt finds the profile already linked to the user.
+		doctorId, err := linkDoctorProfile(ctx, application, user)
+		if err != nil {
+			reopenDoctorApplication(ctx, application.Id)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.Id}, bson.M{"$set": bson.M{"role": helpers.RoleDoctor, "updated_at": time.Now().Unix()}})
+		if err != nil {
+			reopenDoctorApplication(ctx, application.Id)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = helpers.SendDoctorApplicationApprovedEmail(user.FirstName, user.Email, configs.CLIENT+"/doctors/"+doctorId.Hex()); err != nil {
+			log.Println(err)
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: doctorId})
+	}
+}
+
+func RejectDoctorApplication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.DoctorApplicationRejectDTO
+		var user models.User
+		defer cancel()
+
+		applicationId, _ := primitive.ObjectIDFromHex(c.Param("applicationId"))
+		reviewerId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		application, err := reviewDoctorApplication(ctx, applicationId, reviewerId, models.ApplicationRejected, body.Reason)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = userCollection.FindOne(ctx, bson.M{"_id": application.UserId}).Decode(&user); err == nil {
+			if err = helpers.SendDoctorApplicationRejectedEmail(user.FirstName, user.Email, body.Reason); err != nil {
+				log.Println(err)
+			}
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: application.Id})
+	}
+}
+
+// reviewDoctorApplication moves a pending application to its final status exactly once
+func reviewDoctorApplication(ctx context.Context, applicationId primitive.ObjectID, reviewerId primitive.ObjectID, status string, reason string) (models.DoctorApplication, error) {
+	var application models.DoctorApplication
+
+	now := time.Now().Unix()
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := doctorApplicationCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": applicationId, "status": models.ApplicationPending},
+		bson.M{"$set": bson.M{"status": status, "reason": reason, "reviewed_by": reviewerId, "reviewed_at": now, "updated_at": now}},
+		opts,
+	).Decode(&application)
+	if err == mongo.ErrNoDocuments {
+		return application, errors.New("no pending application with this id")
+	}
+	return application, err
+}
+
+// reopenDoctorApplication puts an application claimed by reviewDoctorApplication back in the
+// queue, failing that it has to be fixed by hand and is logged
+func reopenDoctorApplication(ctx context.Context, applicationId primitive.ObjectID) {
+	_, err := doctorApplicationCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": applicationId},
+		bson.M{"$set": bson.M{"status": models.ApplicationPending, "reason": "", "reviewed_by": primitive.NilObjectID, "reviewed_at": int64(0), "updated_at": time.Now().Unix()}},
+	)
+	if err != nil {
+		log.Println("could not reopen doctor application", applicationId.Hex(), err)
+	}
+}
+
+// linkDoctorProfile attaches the profile claimed by the application to the user, or creates
+// a new one, and records the verified license on it
+func linkDoctorProfile(ctx context.Context, application models.DoctorApplication, user models.User) (primitive.ObjectID, error) {
+	doctorId := application.DoctorId
+
+	if doctorId != primitive.NilObjectID {
+		result, err := doctorCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": doctorId, "user_id": primitive.NilObjectID},
+			bson.M{"$set": bson.M{"user_id": user.Id, "updated_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			return doctorId, err
+		}
+		if result.MatchedCount < 1 {
+			doctorId = primitive.NilObjectID
+		}
+	}
+
+	if doctorId == primitive.NilObjectID {
+		var err error
+		if doctorId, err = createDoctorProfile(ctx, user); err != nil {
+			return doctorId, err
+		}
+	}
+
+	license := models.License{
+		Number:        application.LicenseNumber,
+		Country:       application.IssuingCountry,
+		ApplicationId: application.Id,
+		VerifiedAt:    time.Now().Unix(),
+	}
+	_, err := doctorCollection.UpdateOne(ctx, bson.M{"_id": doctorId}, bson.M{"$set": bson.M{"license": license}})
+	return doctorId, err
+}
@@ -7,6 +7,7 @@ import (
 	"doctorrank_go/helpers"
 	"doctorrank_go/models"
 	"doctorrank_go/responses"
+	"errors"
 	"github.com/gin-gonic/gin"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -14,7 +15,10 @@ import (
 	"go.mongodb.org/mongo-driver/mongo/options"
 	"io"
 	"net/http"
+	"net/url"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -24,8 +28,6 @@ func UpdateDoctor() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var updateReq dto.DoctorUpdateDTO
-		var updateFieldName string
-		var updateFieldValue interface{}
 		defer cancel()
 
 		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
@@ -39,32 +41,7 @@ func UpdateDoctor() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
 			return
 		}
-		switch updateReq.FieldName {
-		case "profession_id":
-			updateFieldName = "profession_id"
-			updateFieldValue, _ = primitive.ObjectIDFromHex(updateReq.Value)
-			break
-		case "hospital_id":
-			updateFieldName = "hospital_id"
-			updateFieldValue, _ = primitive.ObjectIDFromHex(updateReq.Value)
-			break
-		case "contact_email":
-			updateFieldName = "contact.email"
-			updateFieldValue = updateReq.Value
-			break
-		case "contact_phone":
-			updateFieldName = "contact.phone"
-			updateFieldValue = updateReq.Value
-			break
-		case "contact_facebook":
-			updateFieldName = "contact.facebook"
-			updateFieldValue = updateReq.Value
-			break
-		default:
-			updateFieldName = updateReq.FieldName
-			updateFieldValue = updateReq.Value
-			break
-		}
+		updateFieldName, updateFieldValue := doctorUpdateField(updateReq)
 
 		updatedAt := time.Now().Unix()
 		result, err := doctorCollection.UpdateOne(
@@ -72,6 +49,9 @@ func UpdateDoctor() gin.HandlerFunc {
 			bson.M{"user_id": userId},
 			bson.M{"$set": bson.M{"updated_at": updatedAt, updateFieldName: updateFieldValue}},
 		)
+		if err == nil && (updateFieldName == "first_name" || updateFieldName == "last_name") {
+			err = refreshDoctorSearchKeys(ctx, bson.M{"user_id": userId})
+		}
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
@@ -82,6 +62,36 @@ func UpdateDoctor() gin.HandlerFunc {
 	}
 }
 
+func doctorUpdateField(updateReq dto.DoctorUpdateDTO) (updateFieldName string, updateFieldValue interface{}) {
+	switch updateReq.FieldName {
+	case "profession_id":
+		updateFieldName = "profession_id"
+		updateFieldValue, _ = primitive.ObjectIDFromHex(updateReq.Value)
+		break
+	case "hospital_id":
+		updateFieldName = "hospital_id"
+		updateFieldValue, _ = primitive.ObjectIDFromHex(updateReq.Value)
+		break
+	case "contact_email":
+		updateFieldName = "contact.email"
+		updateFieldValue = updateReq.Value
+		break
+	case "contact_phone":
+		updateFieldName = "contact.phone"
+		updateFieldValue = updateReq.Value
+		break
+	case "contact_facebook":
+		updateFieldName = "contact.facebook"
+		updateFieldValue = updateReq.Value
+		break
+	default:
+		updateFieldName = updateReq.FieldName
+		updateFieldValue = updateReq.Value
+		break
+	}
+	return updateFieldName, updateFieldValue
+}
+
 func UpdateDoctorExperience() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -222,110 +232,44 @@ func UpdateDoctorEducation() gin.HandlerFunc {
 func AllDoctors() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		var doctors []bson.M
+		var result dto.DoctorSearchResDTO
+		var facets []struct {
+			Total       []struct{ Count int64 } `bson:"total"`
+			Professions []dto.FacetCountResDTO  `bson:"professions"`
+			Hospitals   []dto.FacetCountResDTO  `bson:"hospitals"`
+		}
 		defer cancel()
 
 		queries := c.Request.URL.Query()
-		term := queries.Get("term")
 		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
 		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
 		if limit <= 0 {
 			limit = 12
 		}
 
-		pipeline := []bson.M{
-			{
-				"$lookup": bson.M{
-					"from": "comments",
-					"let":  bson.M{"id": "$_id"},
-					"pipeline": []bson.M{
-						{"$match": bson.M{"$expr": bson.M{"$eq": []string{"$doctor_id", "$$id"}}}},
-						{"$group": bson.M{"_id": nil, "value": bson.M{"$avg": "$rate"}, "count": bson.M{"$sum": 1}}},
-						{"$project": bson.M{"_id": 0}},
-					},
-					"as": "rating",
-				},
-			},
-			{
-				"$unwind": bson.M{"path": "$rating", "preserveNullAndEmptyArrays": true},
-			},
-			{
-				"$project": bson.M{
-					"rating": bson.M{"$ifNull": []interface{}{"$rating", bson.M{"value": 0, "count": 0}}},
-				},
-			},
-			{
-				"$group": bson.M{
-					"_id":   nil,
-					"value": bson.M{"$avg": "$rating.value"},
-					"count": bson.M{"$sum": "$rating.count"},
-				},
-			},
-			{
-				"$project": bson.M{"_id": 0, "genAvg": "$value", "genCount": "$count"},
-			},
-			{
-				"$lookup": bson.M{
-					"from":         "doctors",
-					"localField":   "null",
-					"foreignField": "null",
-					"as":           "doctor",
-				},
-			},
-			{
-				"$unwind": bson.M{"path": "$doctor", "preserveNullAndEmptyArrays": true},
-			},
-			{
-				"$lookup": bson.M{
-					"from": "comments",
-					"let":  bson.M{"id": "$doctor._id"},
-					"pipeline": []bson.M{
-						{
-							"$match": bson.M{"$expr": bson.M{"$eq": []string{"$doctor_id", "$$id"}}},
-						},
-						{
-							"$group": bson.M{"_id": nil, "value": bson.M{"$avg": "$rate"}, "count": bson.M{"$sum": 1}},
-						},
-						{"$project": bson.M{"_id": 0}},
-					},
-					"as": "rating",
-				},
-			},
-			{
-				"$unwind": bson.M{"path": "$rating", "preserveNullAndEmptyArrays": true},
-			},
-			{
-				"$project": bson.M{
-					"doctor":   1,
-					"genAvg":   1,
-					"genCount": 1,
-					"rating":   bson.M{"$ifNull": []interface{}{"$rating", bson.M{"value": 0, "count": 0}}},
-				},
-			},
-			{
-				"$project": bson.M{
-					"genAvg":   1,
-					"genCount": 1,
-					"doctor":   1,
-					"rating":   1,
-					"rank": bson.M{
-						"$divide": []bson.M{
-							{
-								"$sum": []bson.M{
-									{"$multiply": []interface{}{"$rating.value", "$rating.count"}},
-									{"$multiply": []interface{}{"$genAvg", "$genCount"}},
-								},
-							},
-							{"$sum": []interface{}{"$genCount", "$rating.count"}},
-						},
-					},
-				},
-			},
-			{
-				"$replaceRoot": bson.M{
-					"newRoot": bson.M{"$mergeObjects": []interface{}{bson.M{"rank": "$rank", "rating": "$rating"}, "$doctor"}},
-				},
-			},
+		search := newSearchQuery(queries.Get("term"))
+		sortBy, err := doctorSort(queries, search)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		filter, professionFilter, hospitalFilter, err := doctorFilters(queries, search)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// rank and rating are stored on the doctor, see RecomputeRatings, so the page is read
+		// straight from the sort indexes. Only relevance has to be scored per request.
+		pipeline := []bson.M{{"$match": bson.M{"$and": bson.A{filter, professionFilter, hospitalFilter}}}}
+		if sortBy[0].Key == "score" {
+			pipeline = append(pipeline, bson.M{"$addFields": bson.M{"score": search.Score()}})
+		}
+		pipeline = append(pipeline, []bson.M{
+			{"$sort": sortBy},
+			{"$skip": skip},
+			{"$limit": limit},
 			{"$lookup": bson.M{
 				"from":         "professions",
 				"localField":   "profession_id",
@@ -338,41 +282,188 @@ func AllDoctors() gin.HandlerFunc {
 				"foreignField": "_id",
 				"as":           "hospital",
 			}},
-			{"$unwind": "$profession"},
-			{"$unwind": "$hospital"},
+			{"$unwind": bson.M{"path": "$profession", "preserveNullAndEmptyArrays": true}},
+			{"$unwind": bson.M{"path": "$hospital", "preserveNullAndEmptyArrays": true}},
 			{
 				"$project": bson.M{
-					"full_name":  bson.M{"$concat": []string{"$first_name", " ", "$last_name"}},
-					"title":      1,
-					"user_id":    1,
-					"first_name": 1,
-					"last_name":  1,
-					"img":        1,
-					"rank":       1,
-					"rating":     1,
-					"profession": 1,
-					"hospital":   1,
+					"full_name":           bson.M{"$concat": []string{"$first_name", " ", "$last_name"}},
+					"title":               1,
+					"user_id":             1,
+					"first_name":          1,
+					"last_name":           1,
+					"img":                 1,
+					"rank":                1,
+					"ranks":               1,
+					"rating.value":        1,
+					"rating.count":        1,
+					"rating.distribution": 1,
+					"profession":          1,
+					"hospital":            1,
+					"created_at":          1,
+					"score":               1,
 				},
 			},
-			{"$match": bson.M{"full_name": bson.M{"$regex": primitive.Regex{Pattern: term, Options: "i"}}}},
-			{"$sort": bson.M{"rank": -1}},
-			{"$skip": skip},
-			{"$limit": limit},
-		}
+		}...)
 
 		cursor, err := doctorCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &result.Doctors); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// every facet is counted without its own filter, so the other options stay selectable
+		pipeline = []bson.M{
+			{"$match": filter},
+			{"$facet": bson.M{
+				"total":       []bson.M{{"$match": bson.M{"$and": bson.A{professionFilter, hospitalFilter}}}, {"$count": "count"}},
+				"professions": facetCountPipeline(hospitalFilter, "profession_id", "professions"),
+				"hospitals":   facetCountPipeline(professionFilter, "hospital_id", "hospitals"),
+			}},
+		}
 
+		cursor, err = doctorCollection.Aggregate(ctx, pipeline)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
-		if err = cursor.All(ctx, &doctors); err != nil {
+		if err = cursor.All(ctx, &facets); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: doctors})
+		if result.Doctors == nil {
+			result.Doctors = []bson.M{}
+		}
+		result.Facets.Professions = []dto.FacetCountResDTO{}
+		result.Facets.Hospitals = []dto.FacetCountResDTO{}
+		if len(facets) > 0 {
+			if len(facets[0].Total) > 0 {
+				result.Total = facets[0].Total[0].Count
+			}
+			if facets[0].Professions != nil {
+				result.Facets.Professions = facets[0].Professions
+			}
+			if facets[0].Hospitals != nil {
+				result.Facets.Hospitals = facets[0].Hospitals
+			}
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
+
+// doctorFilters turns the listing query into filters. Profession and hospital come separately
+// from the rest so that facets can be counted without them.
+func doctorFilters(queries url.Values, search searchQuery) (filter bson.M, professionFilter bson.M, hospitalFilter bson.M, err error) {
+	filter = listedDoctorsFilter()
+	professionFilter = bson.M{}
+	hospitalFilter = bson.M{}
+
+	if !search.Empty() {
+		for key, value := range search.Filter() {
+			filter[key] = value
+		}
+	}
+	if title := queries.Get("title"); title != "" {
+		filter["title"] = title
+	}
+	if country := queries.Get("country"); country != "" {
+		pattern := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(strings.TrimSpace(country)) + "$", Options: "i"}
+		filter["$or"] = bson.A{bson.M{"experience.country": pattern}, bson.M{"education.country": pattern}}
+	}
+	if value := queries.Get("min_rating"); value != "" {
+		minRating, parseErr := strconv.ParseFloat(value, 64)
+		if parseErr != nil {
+			return nil, nil, nil, errors.New("min_rating must be a number")
+		}
+		filter["rating.value"] = bson.M{"$gte": minRating}
+	}
+	if value := queries.Get("min_reviews"); value != "" {
+		minReviews, parseErr := strconv.ParseInt(value, 10, 64)
+		if parseErr != nil {
+			return nil, nil, nil, errors.New("min_reviews must be a whole number")
+		}
+		filter["rating.count"] = bson.M{"$gte": minReviews}
+	}
+
+	if ids := objectIds(queries["profession_id"]); len(ids) > 0 {
+		professionFilter["profession_id"] = bson.M{"$in": ids}
+	}
+	if ids := objectIds(queries["hospital_id"]); len(ids) > 0 {
+		hospitalFilter["hospital_id"] = bson.M{"$in": ids}
+	}
+
+	return filter, professionFilter, hospitalFilter, nil
+}
+
+// listedDoctorsFilter matches the profiles shown to the public: those without profession or
+// hospital are not listed until they are filled in
+func listedDoctorsFilter() bson.M {
+	return bson.M{"profession_id": bson.M{"$ne": primitive.NilObjectID}, "hospital_id": bson.M{"$ne": primitive.NilObjectID}}
+}
+
+// doctorSort reads sort, one of relevance, rank, rating, reviews, newest and name, and for rank
+// the optional rank_by strategy. Searches are sorted by relevance unless asked otherwise.
+func doctorSort(queries url.Values, search searchQuery) (bson.D, error) {
+	sort := queries.Get("sort")
+	if sort == "" && !search.Empty() {
+		sort = "relevance"
+	}
+
+	switch sort {
+	case "relevance":
+		if search.Empty() {
+			return nil, errors.New("sort by relevance needs a search term")
+		}
+		return bson.D{{Key: "score", Value: -1}, {Key: "rank", Value: -1}, {Key: "_id", Value: 1}}, nil
+	case "", "rank":
+		field := "rank"
+		if rankBy := queries.Get("rank_by"); rankBy != "" {
+			if _, ok := helpers.RankStrategies[rankBy]; !ok {
+				return nil, errors.New("unknown ranking strategy " + rankBy)
+			}
+			field = "ranks." + rankBy
+		}
+		return bson.D{{Key: field, Value: -1}, {Key: "_id", Value: 1}}, nil
+	case "rating":
+		return bson.D{{Key: "rating.value", Value: -1}, {Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}}, nil
+	case "reviews":
+		return bson.D{{Key: "rating.count", Value: -1}, {Key: "_id", Value: 1}}, nil
+	case "newest":
+		return bson.D{{Key: "created_at", Value: -1}, {Key: "_id", Value: 1}}, nil
+	case "name":
+		return bson.D{{Key: "last_name", Value: 1}, {Key: "first_name", Value: 1}, {Key: "_id", Value: 1}}, nil
+	}
+	return nil, errors.New("sort must be one of relevance, rank, rating, reviews, newest or name")
+}
+
+func facetCountPipeline(filter bson.M, field string, from string) []bson.M {
+	return []bson.M{
+		{"$match": filter},
+		{"$group": bson.M{"_id": "$" + field, "count": bson.M{"$sum": 1}}},
+		{"$lookup": bson.M{"from": from, "localField": "_id", "foreignField": "_id", "as": "item"}},
+		{"$unwind": "$item"},
+		{"$project": bson.M{"name": "$item.name", "count": 1}},
+		{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "name", Value: 1}}},
+	}
+}
+
+// objectIds parses repeated or comma separated ids, invalid ones match nothing
+func objectIds(values []string) []primitive.ObjectID {
+	var ids []primitive.ObjectID
+	for _, value := range values {
+		for _, hex := range strings.Split(value, ",") {
+			if hex = strings.TrimSpace(hex); hex != "" {
+				id, _ := primitive.ObjectIDFromHex(hex)
+				ids = append(ids, id)
+			}
+		}
 	}
+	return ids
 }
 
 func DoctorById() gin.HandlerFunc {
@@ -588,3 +679,124 @@ func UploadDoctorAvatar() gin.HandlerFunc {
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: fileName})
 	}
 }
+
+func AdminUpdateDoctor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var updateReq dto.DoctorUpdateDTO
+		defer cancel()
+
+		doctorId, _ := primitive.ObjectIDFromHex(c.Param("doctorId"))
+
+		if err := c.BindJSON(&updateReq); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(updateReq); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		updateFieldName, updateFieldValue := doctorUpdateField(updateReq)
+
+		result, err := doctorCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": doctorId},
+			bson.M{"$set": bson.M{"updated_at": time.Now().Unix(), updateFieldName: updateFieldValue}},
+		)
+		if err == nil && (updateFieldName == "first_name" || updateFieldName == "last_name") {
+			err = refreshDoctorSearchKeys(ctx, bson.M{"_id": doctorId})
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.MatchedCount < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "doctor not found"})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
+
+func DeleteDoctor() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var doctor models.Doctor
+		defer cancel()
+
+		doctorId, _ := primitive.ObjectIDFromHex(c.Param("doctorId"))
+
+		if err := doctorCollection.FindOne(ctx, bson.M{"_id": doctorId}).Decode(&doctor); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "doctor not found"})
+			return
+		}
+
+		if _, err := commentCollection.DeleteMany(ctx, bson.M{"doctor_id": doctorId}); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if _, err := doctorCollection.DeleteOne(ctx, bson.M{"_id": doctorId}); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if doctor.UserId != primitive.NilObjectID {
+			result, err := userCollection.UpdateOne(
+				ctx,
+				bson.M{"_id": doctor.UserId, "role": helpers.RoleDoctor},
+				bson.M{"$set": bson.M{"role": helpers.RoleUser, "updated_at": time.Now().Unix()}},
+			)
+			if err == nil && result.ModifiedCount > 0 {
+				err = revokeSessions(ctx, bson.M{"user_id": doctor.UserId}, "role changed")
+			}
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: doctorId})
+	}
+}
+
+// createDoctorProfile creates the public doctor profile of a user unless one already exists
+func createDoctorProfile(ctx context.Context, user models.User) (primitive.ObjectID, error) {
+	var doctor models.Doctor
+
+	err := doctorCollection.FindOne(ctx, bson.M{"user_id": user.Id}).Decode(&doctor)
+	if err == nil {
+		return doctor.Id, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return primitive.NilObjectID, err
+	}
+
+	doctor.Id = primitive.NewObjectID()
+	doctor.UserId = user.Id
+	doctor.CreatedAt = time.Now().Unix()
+	doctor.UpdatedAt = time.Now().Unix()
+	doctor.FirstName = user.FirstName
+	doctor.LastName = user.LastName
+	doctor.Title = "Dr."
+	doctor.SearchKeys = helpers.SearchKeys(doctor.FirstName, doctor.LastName)
+	doctor.SearchName = helpers.NormalizeSearch(doctor.FirstName + " " + doctor.LastName)
+	doctor.SearchVersion = helpers.SearchKeysVersion
+
+	// without reviews the profile is ranked like updateDoctorRating ranks one, at the prior
+	params, err := rankParams(ctx)
+	if err != nil {
+		return primitive.NilObjectID, err
+	}
+	doctor.Rating.DecayedAt = doctor.CreatedAt
+	doctor.Ranks = helpers.Ranks(doctor.Rating, params, doctor.CreatedAt)
+	doctor.Rank = doctor.Ranks[params.Strategy]
+
+	if _, err = doctorCollection.InsertOne(ctx, doctor); err != nil {
+		return primitive.NilObjectID, errors.New("error creating doctor item")
+	}
+	return doctor.Id, nil
+}
@@ -50,6 +50,9 @@ func CreateHospital() gin.HandlerFunc {
 		}
 		hospital.Id = primitive.NewObjectID()
 		hospital.Name = body.Name
+		hospital.SearchKeys = helpers.SearchKeys(hospital.Name)
+		hospital.SearchName = helpers.NormalizeSearch(hospital.Name)
+		hospital.SearchVersion = helpers.SearchKeysVersion
 
 		_, insertErr := hospitalCollection.InsertOne(ctx, hospital)
 		if insertErr != nil {
@@ -66,20 +69,20 @@ func AllHospitals() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var hospitals []models.Hospital
-		var filter bson.M
 		defer cancel()
 
 		queries := c.Request.URL.Query()
 		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
 		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
-		term := queries.Get("term")
+		search := newSearchQuery(queries.Get("term"))
 		opts := options.FindOptions{Skip: &skip, Limit: &limit}
-		if term == "" {
-			filter = bson.M{}
+		var cursor *mongo.Cursor
+		var err error
+		if search.Empty() {
+			cursor, err = hospitalCollection.Find(ctx, bson.M{}, &opts)
 		} else {
-			filter = bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: term, Options: "i"}}}
+			cursor, err = hospitalCollection.Aggregate(ctx, search.Pipeline(skip, limit))
 		}
-		cursor, err := hospitalCollection.Find(ctx, filter, &opts)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
@@ -164,3 +167,76 @@ func UploadHospitalAvatar() gin.HandlerFunc {
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: fileName})
 	}
 }
+
+func UpdateHospital() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.HospitalDTO
+		defer cancel()
+
+		hospitalId, _ := primitive.ObjectIDFromHex(c.Param("hospitalId"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		count, err := hospitalCollection.CountDocuments(ctx, bson.M{"name": body.Name, "_id": bson.M{"$ne": hospitalId}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this hospital name already exists"})
+			return
+		}
+
+		set := searchFields(body.Name)
+		set["name"] = body.Name
+		result, err := hospitalCollection.UpdateOne(ctx, bson.M{"_id": hospitalId}, bson.M{"$set": set})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.MatchedCount < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "unknown hospital id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
+
+func DeleteHospital() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		hospitalId, _ := primitive.ObjectIDFromHex(c.Param("hospitalId"))
+
+		count, err := doctorCollection.CountDocuments(ctx, bson.M{"hospital_id": hospitalId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if count > 0 {
+			c.JSON(http.StatusConflict, responses.Response{Status: http.StatusConflict, Message: "error", Data: "this hospital is still assigned to doctors"})
+			return
+		}
+
+		result, err := hospitalCollection.DeleteOne(ctx, bson.M{"_id": hospitalId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
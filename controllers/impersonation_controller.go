@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+var impersonationCollection *mongo.Collection = configs.GetCollection(configs.DB, "impersonations")
+var auditLogCollection *mongo.Collection = configs.GetCollection(configs.DB, "audit_logs")
+
+// StartImpersonation issues a read-only access token for another user, valid for
+// helpers.ImpersonationMinutes. Requests made with it are audited by the authentication middleware.
+func StartImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.ImpersonationDTO
+		var user models.User
+		defer cancel()
+
+		adminId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		userId, _ := primitive.ObjectIDFromHex(c.Param("userId"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "user not found"})
+			return
+		}
+
+		if user.Id == adminId {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "you can not impersonate yourself"})
+			return
+		}
+		if helpers.HasPermission(user.Role, helpers.PermissionImpersonateUsers) {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "admin accounts can not be impersonated"})
+			return
+		}
+
+		now := time.Now().Unix()
+		impersonation := models.Impersonation{
+			Id:        primitive.NewObjectID(),
+			AdminId:   adminId,
+			UserId:    user.Id,
+			Reason:    body.Reason,
+			CreatedAt: now,
+			ExpiresAt: now + 60*helpers.ImpersonationMinutes,
+		}
+
+		if _, err := impersonationCollection.InsertOne(ctx, impersonation); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		auditLog := models.AuditLog{Action: models.AuditImpersonationStarted, ActorId: adminId, UserId: user.Id, ImpersonationId: impersonation.Id, Detail: body.Reason}
+		if err := recordAudit(ctx, c, auditLog); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		token, _ := helpers.GenerateImpersonationToken(user, impersonation.Id.Hex(), adminId.Hex())
+
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: dto.ImpersonationResDTO{Token: token, Impersonation: impersonation}})
+	}
+}
+
+// EndImpersonation invalidates an impersonation token before it expires
+func EndImpersonation() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var impersonation models.Impersonation
+		defer cancel()
+
+		adminId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		impersonationId, _ := primitive.ObjectIDFromHex(c.Param("impersonationId"))
+
+		err := impersonationCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": impersonationId, "ended_at": 0},
+			bson.M{"$set": bson.M{"ended_at": time.Now().Unix()}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&impersonation)
+		if err == mongo.ErrNoDocuments {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "impersonation not found or already ended"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		auditLog := models.AuditLog{Action: models.AuditImpersonationEnded, ActorId: adminId, UserId: impersonation.UserId, ImpersonationId: impersonation.Id}
+		if err = recordAudit(ctx, c, auditLog); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: impersonation})
+	}
+}
+
+func AllAuditLogs() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var auditLogs []models.AuditLog
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 50
+		}
+
+		filter := bson.M{}
+		for _, field := range []string{"actor_id", "user_id", "impersonation_id"} {
+			if value := queries.Get(field); value != "" {
+				id, _ := primitive.ObjectIDFromHex(value)
+				filter[field] = id
+			}
+		}
+		if action := queries.Get("action"); action != "" {
+			filter["action"] = action
+		}
+
+		opts := options.Find().SetSort(bson.M{"created_at": -1}).SetSkip(skip).SetLimit(limit)
+		cursor, err := auditLogCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &auditLogs); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: auditLogs})
+	}
+}
+
+func recordAudit(ctx context.Context, c *gin.Context, auditLog models.AuditLog) error {
+	auditLog.Id = primitive.NewObjectID()
+	auditLog.Ip = c.ClientIP()
+	auditLog.UserAgent = c.Request.UserAgent()
+	auditLog.CreatedAt = time.Now().Unix()
+
+	_, err := auditLogCollection.InsertOne(ctx, auditLog)
+	return err
+}
@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var loginAttemptCollection *mongo.Collection = configs.GetCollection(configs.DB, "login_attempts")
+
+const (
+	throttleAccount           = "account"
+	throttleIp                = "ip"
+	throttleResetAccount      = "password_reset_account"
+	throttleResetIp           = "password_reset_ip"
+	throttleMagicLinkAccount  = "magic_link_account"
+	throttleMagicLinkIp       = "magic_link_ip"
+	throttleActivationAccount = "activation_resend_account"
+	throttleActivationIp      = "activation_resend_ip"
+	throttleActivationStatus  = "activation_status_ip"
+	maxLockoutEscalations     = 4
+)
+
+func UnlockAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		claims, msg := helpers.ValidateToken(queries.Get("unlockToken"), helpers.UnlockToken)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
+			return
+		}
+
+		if err := consumeToken(ctx, claims); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err := clearThrottle(ctx, throttleKey(throttleAccount, claims.Id)); err != nil {
+			releaseToken(ctx, claims)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: "account unlocked"})
+	}
+}
+
+func AllLockouts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var attempts []models.LoginAttempt
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 50
+		}
+
+		filter := bson.M{"locked_until": bson.M{"$gt": time.Now().Unix()}}
+		if queries.Get("all") == "true" {
+			filter = bson.M{}
+		}
+		if scope := queries.Get("scope"); scope != "" {
+			filter["scope"] = scope
+		}
+
+		opts := options.Find().SetSort(bson.M{"updated_at": -1}).SetSkip(skip).SetLimit(limit)
+		cursor, err := loginAttemptCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &attempts); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: attempts})
+	}
+}
+
+func ClearLockout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		key := c.Param("key")
+		if err := clearThrottle(ctx, key); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: key})
+	}
+}
+
+func throttleKey(scope string, subject string) string {
+	return scope + ":" + strings.ToLower(subject)
+}
+
+// checkThrottle reports how many seconds the caller has to wait before any of keys may be
+// tried again, and whether the wait is caused by a lockout rather than a delay
+func checkThrottle(ctx context.Context, keys ...string) (int64, bool, error) {
+	var attempts []models.LoginAttempt
+	var wait int64
+	var locked bool
+
+	cursor, err := loginAttemptCollection.Find(ctx, bson.M{"_id": bson.M{"$in": keys}})
+	if err != nil {
+		return 0, false, err
+	}
+	if err = cursor.All(ctx, &attempts); err != nil {
+		return 0, false, err
+	}
+
+	now := time.Now().Unix()
+	for _, attempt := range attempts {
+		if attempt.LockedUntil > now {
+			locked = true
+			if attempt.LockedUntil-now > wait {
+				wait = attempt.LockedUntil - now
+			}
+		} else if attempt.NextAttemptAt-now > wait {
+			wait = attempt.NextAttemptAt - now
+		}
+	}
+
+	return wait, locked, nil
+}
+
+// registerFailure counts a failed attempt against the key and applies the policy's delay.
+// It reports true when this failure locked the key.
+func registerFailure(ctx context.Context, scope string, subject string, policy helpers.ThrottlePolicy) (bool, error) {
+	var attempt models.LoginAttempt
+	now := time.Now().Unix()
+	key := throttleKey(scope, subject)
+
+	// failures outside of the window no longer count
+	_, err := loginAttemptCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": key, "last_failure_at": bson.M{"$lt": now - 60*policy.WindowMinutes}, "locked_until": bson.M{"$lt": now}},
+		bson.M{"$set": bson.M{"failures": 0}},
+	)
+	if err != nil {
+		return false, err
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err = loginAttemptCollection.FindOneAndUpdate(
+		ctx,
+		bson.M{"_id": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"scope": scope, "subject": subject, "last_failure_at": now, "updated_at": now},
+		},
+		opts,
+	).Decode(&attempt)
+	if err != nil {
+		return false, err
+	}
+
+	update := bson.M{"$set": bson.M{"next_attempt_at": now + policy.Delay(attempt.Failures)}}
+	locked := policy.ShouldLock(attempt.Failures) && attempt.LockedUntil < now
+	if locked {
+		escalation := attempt.Lockouts
+		if escalation > maxLockoutEscalations {
+			escalation = maxLockoutEscalations
+		}
+		update["$set"] = bson.M{
+			"next_attempt_at": 0,
+			"failures":        0,
+			"locked_until":    now + 60*(policy.LockoutMinutes<<escalation),
+		}
+		update["$inc"] = bson.M{"lockouts": 1}
+	}
+
+	if _, err = loginAttemptCollection.UpdateOne(ctx, bson.M{"_id": key}, update); err != nil {
+		return false, err
+	}
+
+	return locked, nil
+}
+
+func clearThrottle(ctx context.Context, key string) error {
+	_, err := loginAttemptCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": key},
+		bson.M{"$set": bson.M{"failures": 0, "next_attempt_at": 0, "locked_until": 0, "updated_at": time.Now().Unix()}},
+	)
+	return err
+}
+
+// registerLoginFailure counts a wrong password against both the account and the client ip
+// and emails the owner an unlock link when the account gets locked
+func registerLoginFailure(ctx context.Context, c *gin.Context, user models.User) error {
+	if _, err := registerFailure(ctx, throttleIp, c.ClientIP(), helpers.IpThrottle); err != nil {
+		return err
+	}
+	if user.Id == primitive.NilObjectID {
+		return nil
+	}
+
+	locked, err := registerFailure(ctx, throttleAccount, user.Id.Hex(), helpers.AccountThrottle)
+	if err != nil || !locked {
+		return err
+	}
+
+	unlockToken, err := helpers.GenerateUnlockToken(user.Id.Hex())
+	if err != nil {
+		return err
+	}
+	if err = helpers.SendAccountLockedEmail(user.Email, configs.CLIENT+"/unlock?unlockToken="+unlockToken); err != nil {
+		log.Println(err)
+	}
+	return nil
+}
+
+func abortThrottled(c *gin.Context, wait int64, locked bool) {
+	c.Header("Retry-After", strconv.FormatInt(wait, 10))
+	if locked {
+		c.JSON(http.StatusLocked, responses.Response{Status: http.StatusLocked, Message: "error", Data: fmt.Sprintf("too many failed attempts, locked for %d seconds", wait)})
+		return
+	}
+	c.JSON(http.StatusTooManyRequests, responses.Response{Status: http.StatusTooManyRequests, Message: "error", Data: fmt.Sprintf("too many failed attempts, try again in %d seconds", wait)})
+}
@@ -0,0 +1,148 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+func MagicLinkLogin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MagicLinkDTO
+		var foundUser models.User
+		defer cancel()
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleMagicLinkIp, c.ClientIP()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleMagicLinkIp, c.ClientIP(), helpers.MagicLinkThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if foundUser, err = findUserByLogin(ctx, body.Login); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "user not found"})
+			return
+		}
+
+		// keyed on the account rather than what was typed, so email and username share a budget
+		wait, locked, err = checkThrottle(ctx, throttleKey(throttleMagicLinkAccount, foundUser.Id.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleMagicLinkAccount, foundUser.Id.Hex(), helpers.MagicLinkThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if foundUser.EmailConfirmed != true {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "email not confirmed"})
+			return
+		}
+
+		magicToken, err := helpers.GenerateMagicLinkToken(foundUser.Id.Hex(), body.RememberMe)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = helpers.SendMagicLinkEmail(foundUser.FirstName, foundUser.Email, configs.CLIENT+"/login/magic-link?magicToken="+magicToken); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: "email sent"})
+	}
+}
+
+// VerifyMagicLink exchanges a sign-in link for the same response Login gives. The link stands
+// in for the password only, accounts with two-factor enabled still have to pass LoginMfa.
+func VerifyMagicLink() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MagicLinkVerifyDTO
+		var foundUser models.User
+		defer cancel()
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		claims, msg := helpers.ValidateToken(body.Token, helpers.MagicLinkToken)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
+			return
+		}
+
+		userId, _ := primitive.ObjectIDFromHex(claims.Id)
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&foundUser); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "user not found"})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleAccount, foundUser.Id.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		if foundUser.EmailConfirmed != true {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "email not confirmed"})
+			return
+		}
+
+		// only consumed once the login can go ahead, a throttled attempt keeps the link usable
+		if err = consumeToken(ctx, claims); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if foundUser.Mfa.Enabled {
+			mfaToken, _ := helpers.GenerateMfaToken(foundUser.Id.Hex(), claims.RememberMe)
+			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: dto.MfaRequiredResDTO{MfaRequired: true, MfaToken: mfaToken}})
+			return
+		}
+
+		completeLogin(ctx, c, foundUser, claims.RememberMe)
+	}
+}
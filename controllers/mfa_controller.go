@@ -0,0 +1,331 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"time"
+)
+
+func LoginMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MfaLoginDTO
+		var user models.User
+		defer cancel()
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		claims, msg := helpers.ValidateToken(body.MfaToken, helpers.MfaToken)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: msg})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleIp, c.ClientIP()), throttleKey(throttleAccount, claims.Id))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		userId, _ := primitive.ObjectIDFromHex(claims.Id)
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "user not found"})
+			return
+		}
+
+		valid, err := verifyMfaCode(ctx, user, body.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if !valid {
+			if err = registerLoginFailure(ctx, c, user); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: "invalid two-factor code"})
+			return
+		}
+
+		if err = clearThrottle(ctx, throttleKey(throttleAccount, claims.Id)); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		completeLogin(ctx, c, user, claims.RememberMe)
+	}
+}
+
+func SetupMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MfaSetupDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if passwordIsValid, msg := helpers.VerifyPassword(body.Password, user.Password); !passwordIsValid {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: msg})
+			return
+		}
+
+		if user.Mfa.Enabled {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "two-factor authentication is already enabled"})
+			return
+		}
+
+		secret := helpers.GenerateTotpSecret()
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{"mfa.pending_secret": secret}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		setup := dto.MfaSetupResDTO{Secret: secret, ProvisioningUri: helpers.TotpProvisioningUri(user.Email, secret)}
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: setup})
+	}
+}
+
+func EnableMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MfaCodeDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		sessionId, _ := primitive.ObjectIDFromHex(c.GetString("session_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if user.Mfa.PendingSecret == "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "two-factor setup has not been started"})
+			return
+		}
+
+		step, valid := helpers.VerifyTotp(user.Mfa.PendingSecret, body.Code, time.Now())
+		if !valid {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: "invalid two-factor code"})
+			return
+		}
+
+		recoveryCodes := helpers.GenerateRecoveryCodes()
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{
+			"mfa.enabled":        true,
+			"mfa.secret":         user.Mfa.PendingSecret,
+			"mfa.pending_secret": "",
+			"mfa.recovery_codes": hashRecoveryCodes(recoveryCodes),
+			"mfa.last_used_step": step,
+			"mfa.enabled_at":     time.Now().Unix(),
+			"updated_at":         time.Now().Unix(),
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// sessions opened with the password alone should not outlive enrollment
+		filter := bson.M{"user_id": userId, "_id": bson.M{"$ne": sessionId}}
+		if err = revokeSessions(ctx, filter, "two-factor authentication enabled"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: recoveryCodes})
+	}
+}
+
+func DisableMfa() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MfaDisableDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if !user.Mfa.Enabled {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "two-factor authentication is not enabled"})
+			return
+		}
+
+		if user.Role == helpers.RoleDoctor && configs.MFA_REQUIRED_FOR_DOCTORS {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "two-factor authentication is required for doctor accounts"})
+			return
+		}
+
+		if passwordIsValid, msg := helpers.VerifyPassword(body.Password, user.Password); !passwordIsValid {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: msg})
+			return
+		}
+
+		valid, err := verifyMfaCode(ctx, user, body.Code)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if !valid {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: "invalid two-factor code"})
+			return
+		}
+
+		updateResult, err := userCollection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{
+			"mfa":        models.UserMfa{RecoveryCodes: []string{}},
+			"updated_at": time.Now().Unix(),
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: updateResult})
+	}
+}
+
+func RegenerateRecoveryCodes() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.MfaCodeDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if !user.Mfa.Enabled {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "two-factor authentication is not enabled"})
+			return
+		}
+
+		step, valid := helpers.VerifyTotp(user.Mfa.Secret, body.Code, time.Now())
+		if !valid || step <= user.Mfa.LastUsedStep {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: "invalid two-factor code"})
+			return
+		}
+
+		recoveryCodes := helpers.GenerateRecoveryCodes()
+		_, err := userCollection.UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$set": bson.M{
+			"mfa.recovery_codes": hashRecoveryCodes(recoveryCodes),
+			"mfa.last_used_step": step,
+		}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: recoveryCodes})
+	}
+}
+
+// verifyMfaCode accepts either a TOTP code or one of the user's recovery codes. A TOTP
+// step can only be used once and a recovery code is removed as soon as it is used.
+func verifyMfaCode(ctx context.Context, user models.User, code string) (bool, error) {
+	if step, valid := helpers.VerifyTotp(user.Mfa.Secret, code, time.Now()); valid {
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.Id, "mfa.last_used_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"mfa.last_used_step": step}},
+		)
+		if err != nil {
+			return false, err
+		}
+		return result.ModifiedCount == 1, nil
+	}
+
+	codeHash := helpers.HashToken(helpers.NormalizeRecoveryCode(code))
+	result, err := userCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": user.Id, "mfa.recovery_codes": codeHash},
+		bson.M{"$pull": bson.M{"mfa.recovery_codes": codeHash}},
+	)
+	if err != nil {
+		return false, err
+	}
+	return result.ModifiedCount == 1, nil
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = helpers.HashToken(helpers.NormalizeRecoveryCode(code))
+	}
+	return hashes
+}
@@ -0,0 +1,250 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+var oauthStateCollection *mongo.Collection = configs.GetCollection(configs.DB, "oauth_states")
+
+var usernameCharacters = regexp.MustCompile(`[^a-z0-9_.]`)
+
+func OauthProviders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		names := make([]string, 0, len(helpers.OidcProviders))
+		for name := range helpers.OidcProviders {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: names})
+	}
+}
+
+// OauthAuthorize starts the authorization code flow. The client redirects the browser to the
+// returned url and posts code and state from the provider's redirect to OauthCallback.
+func OauthAuthorize() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		provider, ok := helpers.OidcProviders[c.Param("provider")]
+		if !ok {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "unknown provider"})
+			return
+		}
+
+		now := time.Now().Unix()
+		state := models.OauthState{
+			Id:         helpers.RandomToken(32),
+			Provider:   provider.Name,
+			Verifier:   helpers.RandomToken(32),
+			Nonce:      helpers.RandomToken(16),
+			RememberMe: c.Query("remember_me") == "true",
+			CreatedAt:  now,
+			ExpiresAt:  now + 60*helpers.OidcStateMinutes,
+		}
+
+		authorizationUrl, err := provider.AuthorizationUrl(state.Id, state.Nonce, state.Verifier)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, responses.Response{Status: http.StatusBadGateway, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if _, err = oauthStateCollection.DeleteMany(ctx, bson.M{"expires_at": bson.M{"$lt": now}}); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if _, err = oauthStateCollection.InsertOne(ctx, state); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: authorizationUrl})
+	}
+}
+
+func OauthCallback() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.OauthCallbackDTO
+		var state models.OauthState
+		defer cancel()
+
+		provider, ok := helpers.OidcProviders[c.Param("provider")]
+		if !ok {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "unknown provider"})
+			return
+		}
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		// a state can only be redeemed once
+		filter := bson.M{"_id": body.State, "provider": provider.Name, "expires_at": bson.M{"$gt": time.Now().Unix()}}
+		if err := oauthStateCollection.FindOneAndDelete(ctx, filter).Decode(&state); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "the sign-in request is invalid or expired"})
+			return
+		}
+
+		idToken, err := provider.ExchangeCode(body.Code, state.Verifier)
+		if err != nil {
+			c.JSON(http.StatusBadGateway, responses.Response{Status: http.StatusBadGateway, Message: "error", Data: err.Error()})
+			return
+		}
+
+		claims, err := provider.VerifyIdToken(idToken, state.Nonce)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: err.Error()})
+			return
+		}
+
+		user, err := findOrCreateOauthUser(ctx, provider.Name, claims)
+		if err != nil {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: err.Error()})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleAccount, user.Id.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		if user.Mfa.Enabled {
+			mfaToken, _ := helpers.GenerateMfaToken(user.Id.Hex(), state.RememberMe)
+			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: dto.MfaRequiredResDTO{MfaRequired: true, MfaToken: mfaToken}})
+			return
+		}
+
+		completeLogin(ctx, c, user, state.RememberMe)
+	}
+}
+
+// findOrCreateOauthUser resolves the account behind an identity: an identity linked before,
+// otherwise the account with the same email, which only happens when the provider verified
+// that email, otherwise a new account
+func findOrCreateOauthUser(ctx context.Context, provider string, claims helpers.IdTokenClaims) (models.User, error) {
+	var user models.User
+
+	filter := bson.M{"linked_identities": bson.M{"$elemMatch": bson.M{"provider": provider, "subject": claims.Subject}}}
+	err := userCollection.FindOne(ctx, filter).Decode(&user)
+	if err == nil {
+		return user, nil
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	if claims.Email == "" || !claims.EmailVerified {
+		return user, errors.New("the provider did not confirm your email address")
+	}
+
+	identity := models.LinkedIdentity{
+		Provider: provider,
+		Subject:  claims.Subject,
+		Email:    claims.Email,
+		LinkedAt: time.Now().Unix(),
+	}
+
+	err = userCollection.FindOne(ctx, bson.M{"email": claims.Email}).Decode(&user)
+	if err == nil {
+		// the provider vouches for the address, which also confirms it for us
+		set := bson.M{"email_confirmed": true, "updated_at": time.Now().Unix()}
+		update := bson.M{"$push": bson.M{"linked_identities": identity}, "$set": set}
+		if !user.EmailConfirmed {
+			// whoever registered the address never proved to own it, so nothing they set up may
+			// keep working once its real owner signs in: the password nobody knows can be reset
+			user.Password = helpers.HashPassword(helpers.RandomToken(32))
+			user.Mfa = models.UserMfa{}
+			set["password"] = user.Password
+			set["mfa"] = user.Mfa
+			update["$unset"] = bson.M{"activation_token_id": ""}
+			if err = revokeSessions(ctx, bson.M{"user_id": user.Id}, "email claimed by identity provider"); err != nil {
+				return user, err
+			}
+		}
+		_, err = userCollection.UpdateOne(ctx, bson.M{"_id": user.Id}, update)
+		user.EmailConfirmed = true
+		user.LinkedIdentities = append(user.LinkedIdentities, identity)
+		return user, err
+	}
+	if err != mongo.ErrNoDocuments {
+		return user, err
+	}
+
+	user.Id = primitive.NewObjectID()
+	user.FirstName = claims.GivenName
+	user.LastName = claims.FamilyName
+	if user.FirstName == "" {
+		user.FirstName = claims.Name
+	}
+	user.Email = claims.Email
+	// nobody knows this password, the owner can set one through the password reset flow
+	user.Password = helpers.HashPassword(helpers.RandomToken(32))
+	user.Role = helpers.RoleUser
+	user.EmailConfirmed = true
+	user.LinkedIdentities = []models.LinkedIdentity{identity}
+	user.CreatedAt = time.Now().Unix()
+	user.UpdatedAt = time.Now().Unix()
+
+	// another account may take the username between the check and the insert
+	for attempt := 0; attempt < 3; attempt++ {
+		if user.Username, err = availableUsername(ctx, claims.Email); err != nil {
+			return user, err
+		}
+		if _, err = userCollection.InsertOne(ctx, user); !isUsernameConflict(err) {
+			return user, err
+		}
+	}
+	return user, err
+}
+
+// availableUsername derives a free username from the local part of an email address
+func availableUsername(ctx context.Context, email string) (string, error) {
+	base := usernameCharacters.ReplaceAllString(strings.ToLower(strings.Split(email, "@")[0]), "")
+	if len(base) < 3 {
+		base = "user"
+	}
+	if len(base) > 25 {
+		base = base[:25]
+	}
+
+	username := base
+	for i := 0; i < 5; i++ {
+		taken, err := usernameTaken(ctx, username, primitive.NilObjectID)
+		if err != nil {
+			return "", err
+		}
+		if !taken && helpers.CheckUsername(username) == "" {
+			return username, nil
+		}
+		username = base + "_" + helpers.RandomToken(2)
+	}
+	return "", errors.New("could not find a free username")
+}
@@ -0,0 +1,191 @@
+//go:build integration
+
+// The login flow is run against the mock issuer of cmd/mock-oidc. Like the API itself the test
+// needs a .env and a reachable MongoDB, since the configs package connects on init:
+//
+//	go test -tags integration ./controllers -run Oauth
+package controllers_test
+
+import (
+	"bytes"
+	"context"
+	"doctorrank_go/cmd/mock-oidc/issuer"
+	"doctorrank_go/configs"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/routes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const mockProvider = "mocktest"
+
+var users = configs.GetCollection(configs.DB, "users")
+var sessions = configs.GetCollection(configs.DB, "sessions")
+
+func setUpMockIssuer(t *testing.T) *gin.Engine {
+	mock, err := issuer.New("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(mock.Handler())
+	t.Cleanup(server.Close)
+	mock.Url = server.URL
+
+	helpers.OidcProviders[mockProvider] = &helpers.OidcProvider{
+		Name:        mockProvider,
+		Issuer:      server.URL,
+		ClientId:    "doctorrank",
+		RedirectUri: "http://localhost:3000/oauth/" + mockProvider + "/callback",
+		Scopes:      []string{"openid", "email", "profile"},
+	}
+	t.Cleanup(func() { delete(helpers.OidcProviders, mockProvider) })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	routes.OauthRoute(router)
+	return router
+}
+
+// signIn goes through authorize, the issuer's redirect and the callback the way the client does
+func signIn(t *testing.T, router *gin.Engine, email string) *httptest.ResponseRecorder {
+	return postCallback(router, authorize(t, router, email))
+}
+
+// authorize goes through authorize and the issuer's redirect, returning the body the client
+// posts to the callback
+func authorize(t *testing.T, router *gin.Engine, email string) []byte {
+	var authorization struct{ Data string }
+
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/oauth/"+mockProvider+"/authorize", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("authorize answered %d: %s", recorder.Code, recorder.Body)
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &authorization); err != nil {
+		t.Fatal(err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	response, err := client.Get(authorization.Data + "&login_hint=" + url.QueryEscape(email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	response.Body.Close()
+	redirect, err := url.Parse(response.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"code": redirect.Query().Get("code"), "state": redirect.Query().Get("state")})
+	return body
+}
+
+func postCallback(router *gin.Engine, body []byte) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodPost, "/oauth/"+mockProvider+"/callback", bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func cleanUpUser(t *testing.T, email string) {
+	t.Cleanup(func() {
+		var user models.User
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if users.FindOne(ctx, bson.M{"email": email}).Decode(&user) == nil {
+			sessions.DeleteMany(ctx, bson.M{"user_id": user.Id})
+			users.DeleteOne(ctx, bson.M{"_id": user.Id})
+		}
+	})
+}
+
+func TestOauthCreatesAccount(t *testing.T) {
+	router := setUpMockIssuer(t)
+	email := "oauth-" + helpers.RandomToken(4) + "@example.com"
+	cleanUpUser(t, email)
+
+	recorder := signIn(t, router, email)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var login struct {
+		Data struct {
+			Email string `json:"email"`
+			Token string `json:"token"`
+		}
+	}
+	if err := json.Unmarshal(recorder.Body.Bytes(), &login); err != nil {
+		t.Fatal(err)
+	}
+	if login.Data.Email != email || login.Data.Token == "" {
+		t.Fatalf("expected a login for %s, got %s", email, recorder.Body)
+	}
+}
+
+func TestOauthStateIsSingleUse(t *testing.T) {
+	router := setUpMockIssuer(t)
+	email := "oauth-" + helpers.RandomToken(4) + "@example.com"
+	cleanUpUser(t, email)
+
+	body := authorize(t, router, email)
+	recorder := postCallback(router, body)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", recorder.Code, recorder.Body)
+	}
+
+	recorder = postCallback(router, body)
+	if recorder.Code != http.StatusBadRequest {
+		t.Fatalf("expected a redeemed state to be refused, got %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+// Someone registering the victim's address with their own password must not get into the
+// account once the victim signs in through the provider
+func TestOauthDoesNotAdoptUnconfirmedPassword(t *testing.T) {
+	router := setUpMockIssuer(t)
+	email := "oauth-" + helpers.RandomToken(4) + "@example.com"
+	cleanUpUser(t, email)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	squatter := models.User{
+		Id:        primitive.NewObjectID(),
+		FirstName: "Squatter",
+		Username:  "squatter_" + helpers.RandomToken(4),
+		Email:     email,
+		Password:  helpers.HashPassword("Squatter-Pass-1"),
+		Role:      helpers.RoleUser,
+		CreatedAt: time.Now().Unix(),
+		UpdatedAt: time.Now().Unix(),
+	}
+	if _, err := users.InsertOne(ctx, squatter); err != nil {
+		t.Fatal(err)
+	}
+
+	recorder := signIn(t, router, email)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("callback answered %d: %s", recorder.Code, recorder.Body)
+	}
+
+	var user models.User
+	if err := users.FindOne(ctx, bson.M{"_id": squatter.Id}).Decode(&user); err != nil {
+		t.Fatal(err)
+	}
+	if !user.EmailConfirmed || len(user.LinkedIdentities) != 1 {
+		t.Fatalf("expected the identity to be linked and the email confirmed, got %+v", user)
+	}
+	if ok, _ := helpers.VerifyPassword("Squatter-Pass-1", user.Password); ok {
+		t.Fatal("the password set before the email was confirmed still works")
+	}
+}
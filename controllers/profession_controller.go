@@ -3,6 +3,8 @@ package controllers
 import (
 	"context"
 	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
 	"doctorrank_go/models"
 	"doctorrank_go/responses"
 	"fmt"
@@ -46,6 +48,9 @@ func CreateProfession() gin.HandlerFunc {
 		}
 
 		profession.Id = primitive.NewObjectID()
+		profession.SearchKeys = helpers.SearchKeys(profession.Name)
+		profession.SearchName = helpers.NormalizeSearch(profession.Name)
+		profession.SearchVersion = helpers.SearchKeysVersion
 		resultInsertionNumber, insertErr := professionCollection.InsertOne(ctx, profession)
 		if insertErr != nil {
 			msg := fmt.Sprintf("Error creating profession item")
@@ -61,20 +66,20 @@ func AllProfessions() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
 		var professions []models.Profession
-		var filter primitive.M
 		defer cancel()
 
 		queries := c.Request.URL.Query()
 		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
 		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
-		term := queries.Get("term")
+		search := newSearchQuery(queries.Get("term"))
 		opts := options.FindOptions{Skip: &skip, Limit: &limit}
-		if term == "" {
-			filter = bson.M{}
+		var cursor *mongo.Cursor
+		var err error
+		if search.Empty() {
+			cursor, err = professionCollection.Find(ctx, bson.M{}, &opts)
 		} else {
-			filter = bson.M{"name": bson.M{"$regex": primitive.Regex{Pattern: term, Options: "i"}}}
+			cursor, err = professionCollection.Aggregate(ctx, search.Pipeline(skip, limit))
 		}
-		cursor, err := professionCollection.Find(ctx, filter, &opts)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
@@ -87,3 +92,76 @@ func AllProfessions() gin.HandlerFunc {
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: professions})
 	}
 }
+
+func UpdateProfession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.ProfessionDTO
+		defer cancel()
+
+		professionId, _ := primitive.ObjectIDFromHex(c.Param("professionId"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		count, err := professionCollection.CountDocuments(ctx, bson.M{"name": body.Name, "_id": bson.M{"$ne": professionId}})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this profession name already exists"})
+			return
+		}
+
+		set := searchFields(body.Name)
+		set["name"] = body.Name
+		result, err := professionCollection.UpdateOne(ctx, bson.M{"_id": professionId}, bson.M{"$set": set})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.MatchedCount < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "unknown profession id"})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
+
+func DeleteProfession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		professionId, _ := primitive.ObjectIDFromHex(c.Param("professionId"))
+
+		count, err := doctorCollection.CountDocuments(ctx, bson.M{"profession_id": professionId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if count > 0 {
+			c.JSON(http.StatusConflict, responses.Response{Status: http.StatusConflict, Message: "error", Data: "this profession is still assigned to doctors"})
+			return
+		}
+
+		result, err := professionCollection.DeleteOne(ctx, bson.M{"_id": professionId})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
@@ -0,0 +1,159 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/dto"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func PublicProfile() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var stats []bson.M
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 12
+		}
+
+		// hidden profiles answer exactly like missing ones
+		filter := bson.M{"email_confirmed": true, "privacy.hide_profile": bson.M{"$ne": true}}
+		user, redirectedFrom, err := findUserByUsername(ctx, c.Param("username"), filter)
+		if err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "profile not found"})
+			return
+		}
+
+		profile := dto.PublicProfileResDTO{
+			Username:       user.Username,
+			RedirectedFrom: redirectedFrom,
+			DisplayName:    strings.TrimSpace(user.FirstName + " " + user.LastName),
+			Img:            user.Img,
+			ReviewsHidden:  user.Privacy.UsePseudonym,
+			Reviews:        []bson.M{},
+			CreatedAt:      user.CreatedAt,
+		}
+
+		if user.Privacy.UsePseudonym {
+			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: profile})
+			return
+		}
+
+		pipeline := []bson.M{
+			{"$match": bson.M{"user_id": user.Id}},
+			{"$group": bson.M{"_id": user.Id, "rate": bson.M{"$avg": "$rate"}, "reviews": bson.M{"$sum": 1}}},
+		}
+		cursor, err := commentCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &stats); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if len(stats) > 0 {
+			profile.AverageRating, _ = stats[0]["rate"].(float64)
+			if reviews, ok := stats[0]["reviews"].(int32); ok {
+				profile.ReviewCount = int64(reviews)
+			}
+		}
+
+		pipeline = []bson.M{
+			{"$match": bson.M{"user_id": user.Id}},
+			{"$sort": bson.M{"created_at": -1}},
+			{"$skip": skip},
+			{"$limit": limit},
+			{
+				"$lookup": bson.M{
+					"from":         "doctors",
+					"localField":   "doctor_id",
+					"foreignField": "_id",
+					"as":           "doctor",
+				},
+			},
+			{"$unwind": bson.M{"path": "$doctor", "preserveNullAndEmptyArrays": true}},
+			{
+				"$project": bson.M{
+					"_id":               1,
+					"text":              1,
+					"rate":              1,
+					"likes_count":       bson.M{"$size": bson.M{"$filter": bson.M{"input": bson.M{"$ifNull": bson.A{"$likes", bson.A{}}}, "cond": "$$this.status"}}},
+					"created_at":        1,
+					"updated_at":        1,
+					"doctor._id":        1,
+					"doctor.title":      1,
+					"doctor.first_name": 1,
+					"doctor.last_name":  1,
+					"doctor.img":        1,
+				},
+			},
+		}
+		cursor, err = commentCollection.Aggregate(ctx, pipeline)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &profile.Reviews); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: profile})
+	}
+}
+
+func UpdatePrivacy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.PrivacyDTO
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		privacy := models.UserPrivacy{
+			HideProfile:  body.HideProfile,
+			UsePseudonym: body.UsePseudonym,
+			Pseudonym:    strings.TrimSpace(body.Pseudonym),
+		}
+		if !privacy.UsePseudonym {
+			privacy.Pseudonym = ""
+		} else if privacy.Pseudonym == "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "pseudonym must not be blank"})
+			return
+		}
+
+		updateResult, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": userId},
+			bson.M{"$set": bson.M{"privacy": privacy, "updated_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: updateResult})
+	}
+}
@@ -0,0 +1,356 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+var ratingPriorCollection *mongo.Collection = configs.GetCollection(configs.DB, "rating_priors")
+
+const ratingPriorId = "global"
+
+func RecomputeRatingsNow() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		prior, err := RecomputeRatings(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: prior})
+	}
+}
+
+// ScheduleRatingRecompute rebuilds the ratings right away, which also fills them in for doctors
+// stored before they were materialized, and then every helpers.RatingRecomputeMinutes
+func ScheduleRatingRecompute() {
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		if _, err := RecomputeRatings(ctx); err != nil {
+			log.Println(err)
+		}
+		cancel()
+		time.Sleep(time.Duration(helpers.RatingRecomputeMinutes) * time.Minute)
+	}
+}
+
+// RecomputeRatings rebuilds the rating, ranks and the global prior of every doctor from the
+// comments. Writes racing with it are corrected on the next run.
+func RecomputeRatings(ctx context.Context) (models.RatingPrior, error) {
+	var doctors []models.Doctor
+	var buckets []struct {
+		Id struct {
+			DoctorId primitive.ObjectID `bson:"doctor_id"`
+			Star     float64            `bson:"star"`
+		} `bson:"_id"`
+		Sum          float64 `bson:"sum"`
+		Count        int64   `bson:"count"`
+		DecayedSum   float64 `bson:"decayed_sum"`
+		DecayedCount float64 `bson:"decayed_count"`
+	}
+
+	now := time.Now().Unix()
+	params := helpers.RankConfig
+	weight := commentDecayWeight(now, params.HalfLifeDays)
+
+	pipeline := []bson.M{
+		{"$group": bson.M{
+			"_id":           bson.M{"doctor_id": "$doctor_id", "star": bson.M{"$round": bson.A{"$rate", 0}}},
+			"sum":           bson.M{"$sum": "$rate"},
+			"count":         bson.M{"$sum": 1},
+			"decayed_sum":   bson.M{"$sum": bson.M{"$multiply": bson.A{"$rate", weight}}},
+			"decayed_count": bson.M{"$sum": weight},
+		}},
+	}
+	cursor, err := commentCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return models.RatingPrior{}, err
+	}
+	if err = cursor.All(ctx, &buckets); err != nil {
+		return models.RatingPrior{}, err
+	}
+
+	cursor, err = doctorCollection.Find(ctx, bson.M{}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return models.RatingPrior{}, err
+	}
+	if err = cursor.All(ctx, &doctors); err != nil {
+		return models.RatingPrior{}, err
+	}
+
+	ratings := make(map[primitive.ObjectID]*models.DoctorRating, len(doctors))
+	for _, doctor := range doctors {
+		ratings[doctor.Id] = &models.DoctorRating{Distribution: map[string]int64{}, DecayedAt: now, UpdatedAt: now}
+	}
+
+	prior := models.RatingPrior{Id: ratingPriorId, Doctors: int64(len(doctors)), ComputedAt: now}
+	var total float64
+	for _, bucket := range buckets {
+		rating, ok := ratings[bucket.Id.DoctorId]
+		if !ok {
+			continue
+		}
+		rating.Sum += bucket.Sum
+		rating.Count += bucket.Count
+		rating.DecayedSum += bucket.DecayedSum
+		rating.DecayedCount += bucket.DecayedCount
+		rating.Distribution[helpers.RatingBucket(bucket.Id.Star)] += bucket.Count
+		total += bucket.Sum
+		prior.Comments += bucket.Count
+	}
+	if prior.Comments > 0 {
+		prior.Mean = total / float64(prior.Comments)
+	}
+	params.PriorMean = prior.Mean
+
+	writes := make([]mongo.WriteModel, 0, len(ratings))
+	for doctorId, rating := range ratings {
+		if rating.Count > 0 {
+			rating.Value = rating.Sum / float64(rating.Count)
+		}
+		ranks := helpers.Ranks(*rating, params, now)
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doctorId}).
+			SetUpdate(bson.M{"$set": bson.M{"rating": rating, "ranks": ranks, "rank": ranks[params.Strategy]}}))
+	}
+	if len(writes) > 0 {
+		if _, err = doctorCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false)); err != nil {
+			return prior, err
+		}
+	}
+
+	_, err = ratingPriorCollection.ReplaceOne(ctx, bson.M{"_id": ratingPriorId}, prior, options.Replace().SetUpsert(true))
+	return prior, err
+}
+
+// commentDecayWeight is the weight of a comment's rate as of now, see helpers.Decay
+func commentDecayWeight(now int64, halfLifeDays float64) bson.M {
+	age := bson.M{"$max": bson.A{0, bson.M{"$subtract": bson.A{now, bson.M{"$ifNull": bson.A{"$updated_at", "$created_at"}}}}}}
+	return bson.M{"$pow": bson.A{0.5, bson.M{"$divide": bson.A{age, halfLifeDays * 24 * 60 * 60}}}}
+}
+
+// decayedRatings sums the decayed rates of every doctor's comments for the given half-life
+func decayedRatings(ctx context.Context, now int64, halfLifeDays float64) (map[primitive.ObjectID]models.DoctorRating, error) {
+	var sums []struct {
+		Id           primitive.ObjectID `bson:"_id"`
+		DecayedSum   float64            `bson:"decayed_sum"`
+		DecayedCount float64            `bson:"decayed_count"`
+	}
+
+	weight := commentDecayWeight(now, halfLifeDays)
+	cursor, err := commentCollection.Aggregate(ctx, []bson.M{
+		{"$group": bson.M{
+			"_id":           "$doctor_id",
+			"decayed_sum":   bson.M{"$sum": bson.M{"$multiply": bson.A{"$rate", weight}}},
+			"decayed_count": bson.M{"$sum": weight},
+		}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &sums); err != nil {
+		return nil, err
+	}
+
+	ratings := make(map[primitive.ObjectID]models.DoctorRating, len(sums))
+	for _, sum := range sums {
+		ratings[sum.Id] = models.DoctorRating{DecayedSum: sum.DecayedSum, DecayedCount: sum.DecayedCount, DecayedAt: now}
+	}
+	return ratings, nil
+}
+
+// rankParams are the configured ranking parameters with the prior of the last recompute
+func rankParams(ctx context.Context) (helpers.RankParams, error) {
+	var prior models.RatingPrior
+
+	params := helpers.RankConfig
+	err := ratingPriorCollection.FindOne(ctx, bson.M{"_id": ratingPriorId}).Decode(&prior)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return params, err
+	}
+	params.PriorMean = prior.Mean
+	return params, nil
+}
+
+// updateDoctorRating applies one comment write to the stored rating of a doctor. oldRate is 0
+// for a new comment and newRate is 0 for a deleted one, oldAt is when the old rate was given.
+func updateDoctorRating(ctx context.Context, doctorId primitive.ObjectID, oldRate float64, oldAt int64, newRate float64) error {
+	var doctor models.Doctor
+
+	var count int64
+	distribution := map[string]int64{}
+	if oldRate > 0 {
+		count--
+		distribution[helpers.RatingBucket(oldRate)]--
+	}
+	if newRate > 0 {
+		count++
+		distribution[helpers.RatingBucket(newRate)]++
+	}
+
+	inc := bson.M{"rating.sum": newRate - oldRate, "rating.count": count}
+	for star, delta := range distribution {
+		if delta != 0 {
+			inc["rating.distribution."+star] = delta
+		}
+	}
+
+	// the counters are updated atomically, the derived values below are recomputed from them
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After).SetProjection(bson.M{"rating": 1})
+	if err := doctorCollection.FindOneAndUpdate(ctx, bson.M{"_id": doctorId}, bson.M{"$inc": inc}, opts).Decode(&doctor); err != nil {
+		return err
+	}
+
+	params, err := rankParams(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().Unix()
+
+	rating := doctor.Rating
+	decay := helpers.Decay(rating.DecayedAt, now, params.HalfLifeDays)
+	rating.DecayedSum *= decay
+	rating.DecayedCount *= decay
+	if oldRate > 0 {
+		oldWeight := helpers.Decay(oldAt, now, params.HalfLifeDays)
+		rating.DecayedSum = math.Max(0, rating.DecayedSum-oldRate*oldWeight)
+		rating.DecayedCount = math.Max(0, rating.DecayedCount-oldWeight)
+	}
+	if newRate > 0 {
+		rating.DecayedSum += newRate
+		rating.DecayedCount++
+	}
+	rating.DecayedAt = now
+	rating.Value = 0
+	if rating.Count > 0 {
+		rating.Value = rating.Sum / float64(rating.Count)
+	}
+	ranks := helpers.Ranks(rating, params, now)
+
+	_, err = doctorCollection.UpdateOne(ctx, bson.M{"_id": doctorId}, bson.M{"$set": bson.M{
+		"rating.value":         rating.Value,
+		"rating.decayed_sum":   rating.DecayedSum,
+		"rating.decayed_count": rating.DecayedCount,
+		"rating.decayed_at":    rating.DecayedAt,
+		"rating.updated_at":    now,
+		"ranks":                ranks,
+		"rank":                 ranks[params.Strategy],
+	}})
+	return err
+}
+
+// RankingPreview shows the top doctors under every strategy next to their current position.
+// prior_weight, half_life_days and positive_stars try out other settings without storing them.
+func RankingPreview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var doctors []models.Doctor
+		var prior models.RatingPrior
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		limit, _ := strconv.Atoi(queries.Get("limit"))
+		if limit <= 0 {
+			limit = 10
+		}
+
+		params := helpers.RankConfig
+		if weight, err := strconv.ParseFloat(queries.Get("prior_weight"), 64); err == nil && weight >= 0 {
+			params.PriorWeight = weight
+		}
+		if days, err := strconv.ParseFloat(queries.Get("half_life_days"), 64); err == nil && days > 0 {
+			params.HalfLifeDays = days
+		}
+		if stars, err := strconv.Atoi(queries.Get("positive_stars")); err == nil && stars >= 1 && stars <= 5 {
+			params.PositiveStars = stars
+		}
+
+		err := ratingPriorCollection.FindOne(ctx, bson.M{"_id": ratingPriorId}).Decode(&prior)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		params.PriorMean = prior.Mean
+
+		opts := options.Find().
+			SetProjection(bson.M{"first_name": 1, "last_name": 1, "rating": 1, "rank": 1}).
+			SetSort(bson.D{{Key: "rank", Value: -1}, {Key: "_id", Value: 1}})
+		cursor, err := doctorCollection.Find(ctx, listedDoctorsFilter(), opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &doctors); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		now := time.Now().Unix()
+
+		// the stored decayed sums were built with the configured half-life, another one needs
+		// them summed up again from the comments
+		if params.HalfLifeDays != helpers.RankConfig.HalfLifeDays {
+			decayed, err := decayedRatings(ctx, now, params.HalfLifeDays)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			for i := range doctors {
+				rating := decayed[doctors[i].Id]
+				doctors[i].Rating.DecayedSum = rating.DecayedSum
+				doctors[i].Rating.DecayedCount = rating.DecayedCount
+				doctors[i].Rating.DecayedAt = now
+			}
+		}
+		preview := dto.RankingPreviewResDTO{
+			Strategy:      params.Strategy,
+			PriorMean:     params.PriorMean,
+			PriorWeight:   params.PriorWeight,
+			HalfLifeDays:  params.HalfLifeDays,
+			PositiveStars: params.PositiveStars,
+			Rankings:      map[string][]dto.RankingPreviewItem{},
+		}
+		for name, strategy := range helpers.RankStrategies {
+			items := make([]dto.RankingPreviewItem, len(doctors))
+			for i, doctor := range doctors {
+				items[i] = dto.RankingPreviewItem{
+					DoctorId:        doctor.Id,
+					FullName:        doctor.FirstName + " " + doctor.LastName,
+					Rating:          doctor.Rating.Value,
+					Reviews:         doctor.Rating.Count,
+					Score:           strategy(doctor.Rating, params, now),
+					CurrentPosition: i + 1,
+				}
+			}
+			sort.SliceStable(items, func(i, j int) bool { return items[i].Score > items[j].Score })
+			if len(items) > limit {
+				items = items[:limit]
+			}
+			for i := range items {
+				items[i].Position = i + 1
+			}
+			preview.Rankings[name] = items
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: preview})
+	}
+}
@@ -0,0 +1,320 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"net/http"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var registryEntryCollection *mongo.Collection = configs.GetCollection(configs.DB, "registry_entries")
+
+func ImportRegistry() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 600*time.Second)
+		var body dto.RegistryImportDTO
+		defer cancel()
+
+		if err := c.Bind(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		format := body.Format
+		if format == "" {
+			format = strings.TrimPrefix(filepath.Ext(body.File.Filename), ".")
+		}
+
+		file, err := body.File.Open()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		defer file.Close()
+
+		entries, err := helpers.ParseRegistry(file, format)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		result, err := ImportRegistryEntries(ctx, entries, body.File.Filename)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: result})
+	}
+}
+
+func RegistryDoctorMatches() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var doctors []bson.M
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 20
+		}
+
+		filter := bson.M{"registry_matches.0": bson.M{"$exists": true}}
+		if queries.Get("all") != "true" {
+			filter["license.verified_at"] = bson.M{"$in": bson.A{0, nil}}
+		}
+
+		opts := options.Find().
+			SetSort(bson.M{"registry_matches.0.confidence": -1}).
+			SetSkip(skip).
+			SetLimit(limit).
+			SetProjection(bson.M{"title": 1, "first_name": 1, "last_name": 1, "user_id": 1, "profession_id": 1, "license": 1, "registry_matches": 1})
+		cursor, err := doctorCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &doctors); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: doctors})
+	}
+}
+
+// ImportRegistryEntries upserts entries keyed by license and country and then re-matches
+// pending applications and doctors against the updated registry
+func ImportRegistryEntries(ctx context.Context, entries []models.RegistryEntry, source string) (dto.RegistryImportResDTO, error) {
+	var result dto.RegistryImportResDTO
+	now := time.Now().Unix()
+
+	const batchSize = 1000
+	for start := 0; start < len(entries); start += batchSize {
+		end := start + batchSize
+		if end > len(entries) {
+			end = len(entries)
+		}
+
+		writes := make([]mongo.WriteModel, 0, end-start)
+		for _, entry := range entries[start:end] {
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"license_key": entry.LicenseKey, "country": entry.Country}).
+				SetUpdate(bson.M{
+					"$set": bson.M{
+						"license_number": entry.LicenseNumber,
+						"first_name":     entry.FirstName,
+						"last_name":      entry.LastName,
+						"last_name_key":  entry.LastNameKey,
+						"profession":     entry.Profession,
+						"source":         source,
+						"imported_at":    now,
+					},
+					"$setOnInsert": bson.M{"_id": primitive.NewObjectID()},
+				}).
+				SetUpsert(true))
+		}
+
+		written, err := registryEntryCollection.BulkWrite(ctx, writes)
+		if err != nil {
+			return result, err
+		}
+		result.Inserted += written.UpsertedCount
+		result.Updated += written.MatchedCount
+	}
+
+	var err error
+	result.MatchedApplications, result.MatchedDoctors, err = MatchRegistry(ctx)
+	return result, err
+}
+
+// MatchRegistry refreshes the registry matches of every pending application and every doctor
+// and reports how many of each have at least one match
+func MatchRegistry(ctx context.Context) (int64, int64, error) {
+	var matchedApplications, matchedDoctors int64
+
+	professions, err := professionNames(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	cursor, err := doctorApplicationCollection.Find(ctx, bson.M{"status": models.ApplicationPending})
+	if err != nil {
+		return 0, 0, err
+	}
+	for cursor.Next(ctx) {
+		var application models.DoctorApplication
+		if err = cursor.Decode(&application); err != nil {
+			return 0, 0, err
+		}
+		matches, err := matchDoctorApplication(ctx, application, professions)
+		if err != nil {
+			return 0, 0, err
+		}
+		if len(matches) > 0 {
+			matchedApplications++
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		return 0, 0, err
+	}
+
+	cursor, err = doctorCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return 0, 0, err
+	}
+	for cursor.Next(ctx) {
+		var doctor models.Doctor
+		if err = cursor.Decode(&doctor); err != nil {
+			return 0, 0, err
+		}
+		candidate := helpers.RegistryCandidate{
+			FirstName:     doctor.FirstName,
+			LastName:      doctor.LastName,
+			LicenseNumber: doctor.License.Number,
+			Country:       doctor.License.Country,
+			Profession:    professions[doctor.ProfessionId],
+		}
+		matches, err := findRegistryMatches(ctx, candidate)
+		if err != nil {
+			return 0, 0, err
+		}
+		if err = saveRegistryMatches(ctx, doctorCollection, doctor.Id, matches); err != nil {
+			return 0, 0, err
+		}
+		if len(matches) > 0 {
+			matchedDoctors++
+		}
+	}
+
+	return matchedApplications, matchedDoctors, cursor.Err()
+}
+
+// matchDoctorApplication looks the applicant up in the registry using the name on their account
+// and, when they claim an existing profile, its profession
+func matchDoctorApplication(ctx context.Context, application models.DoctorApplication, professions map[primitive.ObjectID]string) ([]models.RegistryMatch, error) {
+	var user models.User
+	var doctor models.Doctor
+
+	if err := userCollection.FindOne(ctx, bson.M{"_id": application.UserId}).Decode(&user); err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	candidate := helpers.RegistryCandidate{
+		FirstName:     user.FirstName,
+		LastName:      user.LastName,
+		LicenseNumber: application.LicenseNumber,
+		Country:       application.IssuingCountry,
+	}
+	if application.DoctorId != primitive.NilObjectID {
+		err := doctorCollection.FindOne(ctx, bson.M{"_id": application.DoctorId}).Decode(&doctor)
+		if err != nil && err != mongo.ErrNoDocuments {
+			return nil, err
+		}
+		candidate.Profession = professions[doctor.ProfessionId]
+	}
+
+	matches, err := findRegistryMatches(ctx, candidate)
+	if err != nil {
+		return nil, err
+	}
+	return matches, saveRegistryMatches(ctx, doctorApplicationCollection, application.Id, matches)
+}
+
+func findRegistryMatches(ctx context.Context, candidate helpers.RegistryCandidate) ([]models.RegistryMatch, error) {
+	var entries []models.RegistryEntry
+	matches := []models.RegistryMatch{}
+
+	or := bson.A{bson.M{"last_name_key": helpers.NormalizeName(candidate.LastName)}}
+	if license := helpers.NormalizeLicense(candidate.LicenseNumber); license != "" {
+		or = append(or, bson.M{"license_key": license})
+	}
+
+	cursor, err := registryEntryCollection.Find(ctx, bson.M{"$or": or}, options.Find().SetLimit(200))
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		confidence, matchedOn := helpers.ScoreRegistryEntry(candidate, entry)
+		if confidence < helpers.MinRegistryConfidence {
+			continue
+		}
+		matches = append(matches, models.RegistryMatch{
+			EntryId:       entry.Id,
+			LicenseNumber: entry.LicenseNumber,
+			Country:       entry.Country,
+			Name:          strings.TrimSpace(entry.FirstName + " " + entry.LastName),
+			Profession:    entry.Profession,
+			Confidence:    confidence,
+			MatchedOn:     matchedOn,
+		})
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Confidence > matches[j].Confidence })
+	if len(matches) > helpers.MaxRegistryMatches {
+		matches = matches[:helpers.MaxRegistryMatches]
+	}
+	return matches, nil
+}
+
+func saveRegistryMatches(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, matches []models.RegistryMatch) error {
+	update := bson.M{"$set": bson.M{"registry_matches": matches}}
+	if len(matches) == 0 {
+		update = bson.M{"$unset": bson.M{"registry_matches": ""}}
+	}
+	_, err := collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func professionNames(ctx context.Context) (map[primitive.ObjectID]string, error) {
+	var professions []models.Profession
+	names := map[primitive.ObjectID]string{}
+
+	cursor, err := professionCollection.Find(ctx, bson.M{})
+	if err != nil {
+		return nil, err
+	}
+	if err = cursor.All(ctx, &professions); err != nil {
+		return nil, err
+	}
+	for _, profession := range professions {
+		names[profession.Id] = profession.Name
+	}
+	return names, nil
+}
+
+// matchNewDoctorApplication is run once an application is submitted so reviewers see matches right away
+func matchNewDoctorApplication(ctx context.Context, application models.DoctorApplication) {
+	professions, err := professionNames(ctx)
+	if err == nil {
+		_, err = matchDoctorApplication(ctx, application, professions)
+	}
+	if err != nil {
+		log.Println(err)
+	}
+}
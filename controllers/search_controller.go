@@ -0,0 +1,309 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/responses"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// searchQuery is a normalized search term, see helpers.NormalizeSearch
+type searchQuery struct {
+	Normalized string
+	Tokens     []string
+}
+
+func newSearchQuery(term string) searchQuery {
+	tokens := helpers.SearchTokens(term)
+	if len(tokens) > helpers.MaxSearchTokens {
+		tokens = tokens[:helpers.MaxSearchTokens]
+	}
+	return searchQuery{Normalized: strings.Join(tokens, " "), Tokens: tokens}
+}
+
+func (q searchQuery) Empty() bool {
+	return len(q.Tokens) == 0
+}
+
+// Filter matches documents where every token of the query starts one of the search keys. The
+// anchored prefixes can be served from the search_keys index.
+func (q searchQuery) Filter() bson.M {
+	patterns := bson.A{}
+	for _, pattern := range helpers.SearchPrefixes(q.Tokens) {
+		patterns = append(patterns, primitive.Regex{Pattern: pattern})
+	}
+	return bson.M{"search_keys": bson.M{"$all": patterns}}
+}
+
+// ExactFilter narrows Filter to documents having at least one token as a whole key, the ones
+// Score puts first. A short prefix matches far more documents than are scored, these have to
+// be looked up on their own to not be cut off.
+func (q searchQuery) ExactFilter() bson.M {
+	filter := q.Filter()
+	filter["search_keys"].(bson.M)["$in"] = q.Tokens
+	return filter
+}
+
+// Score ranks the matches: a whole word beats a prefix and a name starting with the whole
+// query beats everything else
+func (q searchQuery) Score() bson.M {
+	score := bson.A{bson.M{"$cond": bson.A{bson.M{"$eq": bson.A{bson.M{"$indexOfCP": bson.A{"$search_name", q.Normalized}}, 0}}, 5, 0}}}
+	for _, token := range q.Tokens {
+		score = append(score, bson.M{"$cond": bson.A{bson.M{"$in": bson.A{token, "$search_keys"}}, 3, 1}})
+	}
+	return bson.M{"$add": score}
+}
+
+// Pipeline finds, ranks and pages the matches of collections searched by name
+func (q searchQuery) Pipeline(skip int64, limit int64) []bson.M {
+	pipeline := []bson.M{
+		{"$match": q.Filter()},
+		{"$addFields": bson.M{"score": q.Score()}},
+		{"$sort": bson.D{{Key: "score", Value: -1}, {Key: "name", Value: 1}, {Key: "_id", Value: 1}}},
+		{"$skip": skip},
+	}
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+	return pipeline
+}
+
+// searchFields are what to set on a document to make it findable by the given names
+func searchFields(names ...string) bson.M {
+	return bson.M{
+		"search_keys":    helpers.SearchKeys(names...),
+		"search_name":    helpers.NormalizeSearch(strings.Join(names, " ")),
+		"search_version": helpers.SearchKeysVersion,
+	}
+}
+
+// refreshDoctorSearchKeys derives the search keys of the matching doctors from their names
+func refreshDoctorSearchKeys(ctx context.Context, filter bson.M) error {
+	var doctors []struct {
+		Id        primitive.ObjectID `bson:"_id"`
+		FirstName string             `bson:"first_name"`
+		LastName  string             `bson:"last_name"`
+	}
+
+	cursor, err := doctorCollection.Find(ctx, filter, options.Find().SetProjection(bson.M{"first_name": 1, "last_name": 1}))
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &doctors); err != nil {
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(doctors))
+	for _, doctor := range doctors {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doctor.Id}).
+			SetUpdate(bson.M{"$set": searchFields(doctor.FirstName, doctor.LastName)}))
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err = doctorCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// refreshNameSearchKeys does the same for hospitals and professions, which are found by name
+func refreshNameSearchKeys(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	var items []struct {
+		Id   primitive.ObjectID `bson:"_id"`
+		Name string             `bson:"name"`
+	}
+
+	cursor, err := collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"name": 1}))
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &items); err != nil {
+		return err
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(items))
+	for _, item := range items {
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": item.Id}).
+			SetUpdate(bson.M{"$set": searchFields(item.Name)}))
+	}
+	if len(writes) == 0 {
+		return nil
+	}
+	_, err = collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// EnsureSearchKeys fills in the search keys of documents stored before they existed or derived
+// by an older helpers.SearchKeys
+func EnsureSearchKeys() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+	defer cancel()
+
+	outdated := bson.M{"search_version": bson.M{"$ne": helpers.SearchKeysVersion}}
+	if err := refreshDoctorSearchKeys(ctx, outdated); err != nil {
+		log.Println(err)
+	}
+	if err := refreshNameSearchKeys(ctx, hospitalCollection, outdated); err != nil {
+		log.Println(err)
+	}
+	if err := refreshNameSearchKeys(ctx, professionCollection, outdated); err != nil {
+		log.Println(err)
+	}
+}
+
+// SearchSuggest completes what is typed into the search box with doctors, hospitals and
+// professions in one list, best matches first. Every type is matched through the prefix index
+// on search_keys and only its best candidates and its whole word matches are scored, which
+// keeps it fast enough to call on every keystroke.
+func SearchSuggest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		suggestions := []dto.SuggestionResDTO{}
+		defer cancel()
+
+		search := newSearchQuery(c.Query("q"))
+		if search.Empty() {
+			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: suggestions})
+			return
+		}
+
+		limits := map[string]int64{}
+		for suggestionType, limit := range helpers.SuggestLimits {
+			limits[suggestionType] = limit
+		}
+		if value := c.Query("limit"); value != "" {
+			limit, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || limit < 1 {
+				c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "limit must be a positive whole number"})
+				return
+			}
+			if limit > helpers.MaxSuggestLimit {
+				limit = helpers.MaxSuggestLimit
+			}
+			for suggestionType := range limits {
+				limits[suggestionType] = limit
+			}
+		}
+
+		byName := func(a, b dto.SuggestionResDTO) bool {
+			if a.Name != b.Name {
+				return a.Name < b.Name
+			}
+			return a.Id.Hex() < b.Id.Hex()
+		}
+
+		sources := []struct {
+			suggestionType string
+			collection     *mongo.Collection
+			base           bson.M // like the listing, doctors without profession or hospital are not suggested
+			sort           bson.D
+			less           func(a, b dto.SuggestionResDTO) bool
+			project        bson.M
+		}{
+			{
+				helpers.SuggestDoctor, doctorCollection, listedDoctorsFilter(),
+				bson.D{{Key: "rank", Value: -1}, {Key: "_id", Value: 1}},
+				func(a, b dto.SuggestionResDTO) bool {
+					if a.Rank != b.Rank {
+						return a.Rank > b.Rank
+					}
+					return a.Id.Hex() < b.Id.Hex()
+				},
+				bson.M{"name": bson.M{"$concat": []string{"$first_name", " ", "$last_name"}}, "title": 1, "img": 1, "rank": 1},
+			},
+			{
+				helpers.SuggestHospital, hospitalCollection, bson.M{},
+				bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+				byName,
+				bson.M{"name": 1},
+			},
+			{
+				helpers.SuggestProfession, professionCollection, bson.M{},
+				bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}},
+				byName,
+				bson.M{"name": 1},
+			},
+		}
+
+		for _, source := range sources {
+			var found []dto.SuggestionResDTO
+			limit := limits[source.suggestionType]
+
+			source.project["score"] = 1
+			source.project["type"] = bson.M{"$literal": source.suggestionType}
+
+			// the best of the first candidates and the best of the whole word matches, together
+			// they hold the best matches overall
+			seen := map[primitive.ObjectID]bool{}
+			for _, filter := range []bson.M{search.Filter(), search.ExactFilter()} {
+				var candidates []dto.SuggestionResDTO
+
+				for key, value := range source.base {
+					filter[key] = value
+				}
+				pipeline := []bson.M{
+					{"$match": filter},
+					{"$sort": source.sort},
+					{"$limit": helpers.SuggestCandidates},
+					{"$addFields": bson.M{"score": search.Score()}},
+					{"$sort": append(bson.D{{Key: "score", Value: -1}}, source.sort...)},
+					{"$limit": limit},
+					{"$project": source.project},
+				}
+
+				cursor, err := source.collection.Aggregate(ctx, pipeline)
+				if err != nil {
+					c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+					return
+				}
+				if err = cursor.All(ctx, &candidates); err != nil {
+					c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+					return
+				}
+				for _, candidate := range candidates {
+					if !seen[candidate.Id] {
+						seen[candidate.Id] = true
+						found = append(found, candidate)
+					}
+				}
+			}
+
+			sort.Slice(found, func(i, j int) bool {
+				if found[i].Score != found[j].Score {
+					return found[i].Score > found[j].Score
+				}
+				return source.less(found[i], found[j])
+			})
+			if int64(len(found)) > limit {
+				found = found[:limit]
+			}
+			suggestions = append(suggestions, found...)
+		}
+
+		for i, suggestion := range suggestions {
+			if suggestion.Type == helpers.SuggestDoctor && suggestion.Img != "" {
+				suggestions[i].Thumbnail = "/" + helpers.Folders.Doctor + "/thumbnail/" + suggestion.Img
+			}
+		}
+
+		// the types are already in order among themselves, a stable sort keeps doctors before
+		// hospitals and professions of the same score
+		sort.SliceStable(suggestions, func(i, j int) bool {
+			return suggestions[i].Score > suggestions[j].Score
+		})
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: suggestions})
+	}
+}
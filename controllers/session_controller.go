@@ -0,0 +1,242 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"time"
+)
+
+var sessionCollection *mongo.Collection = configs.GetCollection(configs.DB, "sessions")
+
+// rotatedHashesKept is how many superseded refresh tokens of a session are remembered to detect
+// their reuse. A stolen token is almost always replayed within the last few rotations.
+const rotatedHashesKept = 10
+
+var errSessionRevoked = errors.New("session has been revoked")
+var errRefreshTokenReused = errors.New("refresh token reuse detected, session revoked")
+
+func AllSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var sessions []dto.SessionResDTO
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		currentSessionId, _ := primitive.ObjectIDFromHex(c.GetString("session_id"))
+
+		filter := bson.M{"user_id": userId, "revoked_at": 0, "expires_at": bson.M{"$gt": time.Now().Unix()}}
+		opts := options.Find().SetSort(bson.M{"last_refreshed_at": -1})
+		cursor, err := sessionCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &sessions); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		for i := range sessions {
+			sessions[i].Current = sessions[i].Id == currentSessionId
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: sessions})
+	}
+}
+
+func RevokeSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		sessionId, err := primitive.ObjectIDFromHex(c.Param("sessionId"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "invalid session id"})
+			return
+		}
+
+		count, err := sessionCollection.CountDocuments(ctx, bson.M{"_id": sessionId, "user_id": userId, "revoked_at": 0})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count < 1 {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "session not found"})
+			return
+		}
+
+		if err = revokeSessions(ctx, bson.M{"_id": sessionId, "user_id": userId}, "signed out remotely"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: sessionId})
+	}
+}
+
+func RevokeOtherSessions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+		currentSessionId, _ := primitive.ObjectIDFromHex(c.GetString("session_id"))
+
+		filter := bson.M{"user_id": userId, "_id": bson.M{"$ne": currentSessionId}}
+		if err := revokeSessions(ctx, filter, "signed out remotely"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: "signed out of all other sessions"})
+	}
+}
+
+// createSession stores a new refresh token family for the user and returns its first refresh token
+func createSession(ctx context.Context, c *gin.Context, userId primitive.ObjectID, rememberMe bool) (models.Session, string, error) {
+	var session models.Session
+
+	session.Id = primitive.NewObjectID()
+	refreshToken, err := helpers.GenerateRefreshToken(userId.Hex(), session.Id.Hex())
+	if err != nil {
+		return session, "", err
+	}
+
+	now := time.Now().Unix()
+	session.UserId = userId
+	session.TokenHash = helpers.HashToken(refreshToken)
+	session.RotatedHashes = []string{}
+	session.RememberMe = rememberMe
+	session.UserAgent = c.Request.UserAgent()
+	session.Ip = c.ClientIP()
+	session.CreatedAt = now
+	session.LastRefreshedAt = now
+	session.ExpiresAt = now + 60*helpers.RefreshTokenMinutes
+
+	if _, err = sessionCollection.InsertOne(ctx, session); err != nil {
+		return session, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// rotateSession exchanges a refresh token for a new one. Presenting a token that has
+// already been rotated revokes the whole session, since it means the token was copied.
+func rotateSession(ctx context.Context, c *gin.Context, refreshToken string) (models.Session, string, error) {
+	var session models.Session
+
+	claims, msg := helpers.ValidateToken(refreshToken, helpers.RefreshToken)
+	if msg != "" {
+		return session, "", errors.New(msg)
+	}
+	sessionId, err := primitive.ObjectIDFromHex(claims.SessionId)
+	if err != nil {
+		return session, "", errors.New("the token is invalid")
+	}
+
+	if err = sessionCollection.FindOne(ctx, bson.M{"_id": sessionId}).Decode(&session); err != nil {
+		return session, "", errors.New("session not found")
+	}
+	if session.RevokedAt != 0 {
+		return session, "", errSessionRevoked
+	}
+
+	tokenHash := helpers.HashToken(refreshToken)
+	if session.TokenHash != tokenHash {
+		for _, rotatedHash := range session.RotatedHashes {
+			if rotatedHash == tokenHash {
+				if err = revokeSessions(ctx, bson.M{"_id": session.Id}, "refresh token reuse"); err != nil {
+					return session, "", err
+				}
+				return session, "", errRefreshTokenReused
+			}
+		}
+		return session, "", errors.New("the token is invalid")
+	}
+
+	newRefreshToken, err := helpers.GenerateRefreshToken(session.UserId.Hex(), session.Id.Hex())
+	if err != nil {
+		return session, "", err
+	}
+
+	now := time.Now().Unix()
+	result, err := sessionCollection.UpdateOne(
+		ctx,
+		bson.M{"_id": session.Id, "token_hash": tokenHash, "revoked_at": 0},
+		bson.M{
+			"$set": bson.M{
+				"token_hash":        helpers.HashToken(newRefreshToken),
+				"last_refreshed_at": now,
+				"expires_at":        now + 60*helpers.RefreshTokenMinutes,
+				"user_agent":        c.Request.UserAgent(),
+				"ip":                c.ClientIP(),
+			},
+			"$push": bson.M{"rotated_hashes": bson.M{"$each": bson.A{tokenHash}, "$slice": -rotatedHashesKept}},
+		},
+	)
+	if err != nil {
+		return session, "", err
+	}
+	if result.ModifiedCount == 0 {
+		// another request rotated this token first, treat it as reuse
+		if err = revokeSessions(ctx, bson.M{"_id": session.Id}, "refresh token reuse"); err != nil {
+			return session, "", err
+		}
+		return session, "", errRefreshTokenReused
+	}
+
+	return session, newRefreshToken, nil
+}
+
+// revokeSessions marks every active session matching filter as revoked
+func revokeSessions(ctx context.Context, filter bson.M, reason string) error {
+	filter["revoked_at"] = 0
+	_, err := sessionCollection.UpdateMany(
+		ctx,
+		filter,
+		bson.M{"$set": bson.M{"revoked_at": time.Now().Unix(), "revoked_reason": reason}},
+	)
+	return err
+}
+
+func setRefreshCookie(c *gin.Context, refreshToken string, rememberMe bool) {
+	maxCookieAge := 0
+	if rememberMe {
+		maxCookieAge = 60 * int(helpers.RefreshTokenMinutes)
+	}
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "refreshToken",
+		Value:    refreshToken,
+		Path:     "/",
+		Domain:   configs.Env("DOMAIN"),
+		MaxAge:   maxCookieAge,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+		HttpOnly: true,
+	})
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     "refreshToken",
+		Value:    "",
+		Path:     "/",
+		Domain:   configs.Env("DOMAIN"),
+		MaxAge:   -1,
+		SameSite: http.SameSiteNoneMode,
+		Secure:   true,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
+	"net/http"
+	"time"
+)
+
+var consumedTokenCollection *mongo.Collection = configs.GetCollection(configs.DB, "consumed_tokens")
+
+var errTokenAlreadyUsed = errors.New("the token has already been used")
+
+// Jwks serves the public signing keys in RFC 7517 format so other services can verify
+// access tokens without holding a secret
+func Jwks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Header("Cache-Control", "public, max-age=300")
+		c.JSON(http.StatusOK, helpers.Keys.Jwks())
+	}
+}
+
+// consumeToken records the token's jti so single-use tokens cannot be replayed. The insert is
+// what makes concurrent uses of one token fail, so it runs before the change the token
+// authorizes, and releaseToken hands the token back when that change could not be made.
+func consumeToken(ctx context.Context, claims *helpers.SignedDetails) error {
+	subject := claims.Email
+	if subject == "" {
+		subject = claims.Id
+	}
+
+	consumedToken := models.ConsumedToken{
+		Id:         claims.StandardClaims.Id,
+		Type:       string(claims.Type),
+		Subject:    subject,
+		ConsumedAt: time.Now().Unix(),
+		ExpiresAt:  time.Unix(claims.ExpiresAt, 0),
+	}
+
+	if _, err := consumedTokenCollection.InsertOne(ctx, consumedToken); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return errTokenAlreadyUsed
+		}
+		return err
+	}
+	return nil
+}
+
+// releaseToken makes a consumed token usable again
+func releaseToken(ctx context.Context, claims *helpers.SignedDetails) {
+	if _, err := consumedTokenCollection.DeleteOne(ctx, bson.M{"_id": claims.StandardClaims.Id}); err != nil {
+		log.Println(err)
+	}
+}
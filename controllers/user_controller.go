@@ -7,14 +7,21 @@ import (
 	"doctorrank_go/helpers"
 	"doctorrank_go/models"
 	"doctorrank_go/responses"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
+	"os"
+	"regexp"
+	"strconv"
 	"time"
 )
 
@@ -50,45 +57,64 @@ func Register() gin.HandlerFunc {
 			return
 		}
 
-		count, err = userCollection.CountDocuments(ctx, bson.M{"username": register.Username})
+		if reason := helpers.CheckUsername(register.Username); reason != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: reason})
+			return
+		}
+
+		taken, err := usernameTaken(ctx, register.Username, primitive.NilObjectID)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
 
-		if count > 0 {
+		if taken {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "this username already exists"})
 			return
 		}
 
+		if violations := helpers.Passwords.Check(register.Password, register.Username, register.Email); len(violations) > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: violations})
+			return
+		}
+
 		user.FirstName = register.FirstName
 		user.LastName = register.LastName
 		user.Username = register.Username
 		user.Email = register.Email
 		user.Password = helpers.HashPassword(register.Password)
-		user.Role = "user"
+		user.Role = helpers.RoleUser
 		user.CreatedAt = time.Now().Unix()
 		user.UpdatedAt = time.Now().Unix()
 		user.Id = primitive.NewObjectID()
+		user.ActivationTokenId = helpers.RandomToken(16)
 
-		signedActivationToken, err := helpers.GenerateEmailToken(user.Email)
+		signedActivationToken, err := helpers.GenerateActivationToken(user.Email, user.ActivationTokenId)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
 
-		if err = helpers.SendConfirmationMail(user.FirstName, user.Email, configs.CLIENT+"/activation?activationToken="+signedActivationToken); err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
+		if isUsernameConflict(insertErr) {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "this username already exists"})
 			return
 		}
-
-		resultInsertionNumber, insertErr := userCollection.InsertOne(ctx, user)
 		if insertErr != nil {
 			msg := fmt.Sprintf("User could not be not created")
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
 			return
 		}
 
+		// without the email the account could never be activated, so the registration is undone
+		if err = helpers.SendConfirmationMail(user.FirstName, user.Email, configs.CLIENT+"/activation?activationToken="+signedActivationToken); err != nil {
+			if _, deleteErr := userCollection.DeleteOne(ctx, bson.M{"_id": user.Id}); deleteErr != nil {
+				log.Println(deleteErr)
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
 		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: resultInsertionNumber})
 	}
 }
@@ -99,177 +125,292 @@ func ActivateProfile() gin.HandlerFunc {
 		defer cancel()
 		queries := c.Request.URL.Query()
 		activationToken := queries.Get("activationToken")
-		claims, msg := helpers.ValidateToken(activationToken)
+		claims, msg := helpers.ValidateToken(activationToken, helpers.ActivationToken)
 		if msg != "" {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
 			return
 		}
 
-		filter := bson.M{"email": claims.Email}
-		update := bson.M{"$set": bson.M{"email_confirmed": true}}
+		if err := consumeToken(ctx, claims); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// accounts registered before activation ids were stored have no id to compare against
+		filter := bson.M{"email": claims.Email, "activation_token_id": bson.M{"$in": bson.A{claims.StandardClaims.Id, nil}}}
+		update := bson.M{"$set": bson.M{"email_confirmed": true}, "$unset": bson.M{"activation_token_id": ""}}
 		updateResult, err := userCollection.UpdateOne(ctx, filter, update)
 		if err != nil {
+			releaseToken(ctx, claims)
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
+		if updateResult.MatchedCount < 1 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this activation link has been replaced by a newer one"})
+			return
+		}
 
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: updateResult})
 	}
 }
 
-func Login() gin.HandlerFunc {
+func ResendActivation() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		var loginCredentials dto.LoginDTO
-		var loginRes dto.LoginResDTO
-		var foundUser models.User
+		var body dto.ActivationResendDTO
+		var user models.User
 		defer cancel()
 
-		if err := c.BindJSON(&loginCredentials); err != nil {
+		if err := c.BindJSON(&body); err != nil {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
 			return
 		}
 
-		filter := bson.M{"$or": bson.A{bson.M{"email": loginCredentials.Login}, bson.M{"username": loginCredentials.Login}}}
-		err := userCollection.FindOne(ctx, filter).Decode(&foundUser)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "username or password is incorrect"})
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
 			return
 		}
 
-		passwordIsValid, msg := helpers.VerifyPassword(loginCredentials.Password, foundUser.Password)
-		if passwordIsValid != true {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleActivationIp, c.ClientIP()), throttleKey(throttleActivationAccount, body.Email))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleActivationIp, c.ClientIP(), helpers.ActivationResendThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if _, err = registerFailure(ctx, throttleActivationAccount, body.Email, helpers.ActivationResendThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
 
-		if foundUser.EmailConfirmed != true {
-			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "email not confirmed"})
+		// unknown and already confirmed addresses get the same answer, so this cannot be used to
+		// find out who is registered
+		err = userCollection.FindOne(ctx, bson.M{"email": body.Email}).Decode(&user)
+		if err == mongo.ErrNoDocuments || (err == nil && user.EmailConfirmed) {
+			c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: "email sent"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
 
-		token, _ := helpers.GenerateToken(foundUser.Email, foundUser.FirstName, foundUser.LastName, foundUser.Id.Hex())
-		refreshToken, _ := helpers.GenerateRefreshToken(foundUser.Id.Hex())
+		activationId := helpers.RandomToken(16)
+		signedActivationToken, err := helpers.GenerateActivationToken(user.Email, activationId)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
 
-		maxCookieAge := 0
-		if loginCredentials.RememberMe {
-			maxCookieAge = 60 * int(helpers.RefreshTokenMinutes)
+		// replacing the stored id invalidates every link sent before
+		_, err = userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.Id},
+			bson.M{"$set": bson.M{"activation_token_id": activationId, "updated_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
 		}
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "refreshToken",
-			Value:    refreshToken,
-			Path:     "/",
-			Domain:   configs.Env("DOMAIN"),
-			MaxAge:   maxCookieAge,
-			SameSite: http.SameSiteNoneMode,
-			Secure:   true,
-			HttpOnly: true,
-		})
 
-		bsonBytes, _ := bson.Marshal(foundUser)
-		bson.Unmarshal(bsonBytes, &loginRes)
-		loginRes.Token = token
+		if err = helpers.SendConfirmationMail(user.FirstName, user.Email, configs.CLIENT+"/activation?activationToken="+signedActivationToken); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: loginRes})
+		c.JSON(http.StatusCreated, responses.Response{Status: http.StatusCreated, Message: "success", Data: "email sent"})
 	}
 }
 
-func Logout() gin.HandlerFunc {
+func ActivationStatus() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var _, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var user models.User
 		defer cancel()
 
-		http.SetCookie(c.Writer, &http.Cookie{
-			Name:     "refreshToken",
-			Value:    "",
-			Path:     "/",
-			Domain:   configs.Env("DOMAIN"),
-			MaxAge:   -1,
-			SameSite: http.SameSiteNoneMode,
-			Secure:   true,
-			HttpOnly: true,
-		})
+		email := c.Request.URL.Query().Get("email")
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: "logged out"})
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleActivationIp, c.ClientIP()), throttleKey(throttleActivationStatus, c.ClientIP()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleActivationStatus, c.ClientIP(), helpers.ActivationStatusThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		// an unknown address reads like one that still waits for confirmation
+		err = userCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		wait, _, err = checkThrottle(ctx, throttleKey(throttleActivationAccount, email))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		status := dto.ActivationStatusResDTO{Email: email, EmailConfirmed: user.EmailConfirmed, ResendAvailableIn: wait}
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: status})
 	}
 }
 
-func Refresh() gin.HandlerFunc {
+func Login() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		var user models.User
+		var loginCredentials dto.LoginDTO
+		var foundUser models.User
 		defer cancel()
 
-		cookie, err := c.Cookie("refreshToken")
-		if err != nil {
+		if err := c.BindJSON(&loginCredentials); err != nil {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
 			return
 		}
-		userDetails, msg := helpers.ValidateToken(cookie)
-		if msg != "" {
-			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleIp, c.ClientIP()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
-		id, err := primitive.ObjectIDFromHex(userDetails.Id)
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		foundUser, err = findUserByLogin(ctx, loginCredentials.Login)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			if err = registerLoginFailure(ctx, c, foundUser); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "username or password is incorrect"})
 			return
 		}
 
-		err = userCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user)
+		wait, locked, err = checkThrottle(ctx, throttleKey(throttleAccount, foundUser.Id.Hex()))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "incorrect user id"})
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
 			return
 		}
 
-		token, _ := helpers.GenerateToken(user.Email, user.FirstName, user.LastName, user.Id.Hex())
+		passwordIsValid, msg := helpers.VerifyPassword(loginCredentials.Password, foundUser.Password)
+		if passwordIsValid != true {
+			if err = registerLoginFailure(ctx, c, foundUser); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+			return
+		}
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: token})
+		if foundUser.EmailConfirmed != true {
+			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "email not confirmed"})
+			return
+		}
+
+		if foundUser.Mfa.Enabled {
+			mfaToken, _ := helpers.GenerateMfaToken(foundUser.Id.Hex(), loginCredentials.RememberMe)
+			c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: dto.MfaRequiredResDTO{MfaRequired: true, MfaToken: mfaToken}})
+			return
+		}
+
+		// with two-factor enabled the counter is only reset once the second factor passes
+		if err = clearThrottle(ctx, throttleKey(throttleAccount, foundUser.Id.Hex())); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		completeLogin(ctx, c, foundUser, loginCredentials.RememberMe)
+	}
+}
+
+// completeLogin opens a session for an authenticated user and writes the login response
+func completeLogin(ctx context.Context, c *gin.Context, user models.User, rememberMe bool) {
+	var loginRes dto.LoginResDTO
+
+	session, refreshToken, err := createSession(ctx, c, user.Id, rememberMe)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+		return
 	}
+	token, _ := helpers.GenerateToken(user, session.Id.Hex())
+	setRefreshCookie(c, refreshToken, rememberMe)
+
+	bsonBytes, _ := bson.Marshal(user)
+	bson.Unmarshal(bsonBytes, &loginRes)
+	loginRes.Token = token
+	loginRes.MfaEnabled = user.Mfa.Enabled
+
+	c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: loginRes})
 }
 
-func ChangeUserRole() gin.HandlerFunc {
+func Logout() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		var user models.User
-		var doctor models.Doctor
 		defer cancel()
-		id := c.GetString("_id")
-		objId, _ := primitive.ObjectIDFromHex(id)
 
-		_, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"_id": objId},
-			bson.M{"$set": bson.D{{"role", "doctor"}}},
-		)
+		if cookie, err := c.Cookie("refreshToken"); err == nil {
+			if claims, msg := helpers.ValidateToken(cookie, helpers.RefreshToken); msg == "" {
+				sessionId, _ := primitive.ObjectIDFromHex(claims.SessionId)
+				if err = revokeSessions(ctx, bson.M{"_id": sessionId}, "logout"); err != nil {
+					c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+					return
+				}
+			}
+		}
+		clearRefreshCookie(c)
 
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: "logged out"})
+	}
+}
+
+func Refresh() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var user models.User
+		defer cancel()
+
+		cookie, err := c.Cookie("refreshToken")
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
 			return
 		}
-
-		filter := bson.M{"$or": bson.A{bson.M{"_id": objId}}}
-		if err := userCollection.FindOne(ctx, filter).Decode(&user); err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+		session, refreshToken, err := rotateSession(ctx, c, cookie)
+		if err != nil {
+			if err == errRefreshTokenReused || err == errSessionRevoked {
+				clearRefreshCookie(c)
+			}
+			c.JSON(http.StatusUnauthorized, responses.Response{Status: http.StatusUnauthorized, Message: "error", Data: err.Error()})
 			return
 		}
 
-		doctor.Id = primitive.NewObjectID()
-		doctor.UserId = objId
-		doctor.CreatedAt = time.Now().Unix()
-		doctor.UpdatedAt = time.Now().Unix()
-		doctor.FirstName = user.FirstName
-		doctor.LastName = user.LastName
-		doctor.Title = "Dr."
-
-		resultInsertionNumber, insertErr := doctorCollection.InsertOne(ctx, doctor)
-		if insertErr != nil {
-			msg := fmt.Sprintf("Error creating doctor item")
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+		err = userCollection.FindOne(ctx, bson.M{"_id": session.UserId}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "incorrect user id"})
 			return
 		}
 
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: resultInsertionNumber})
+		token, _ := helpers.GenerateToken(user, session.Id.Hex())
+		setRefreshCookie(c, refreshToken, session.RememberMe)
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: token})
 	}
 }
 
@@ -331,14 +472,42 @@ func PasswordResetEmail() gin.HandlerFunc {
 		queries := c.Request.URL.Query()
 		login := queries.Get("login")
 
-		filter := bson.M{"$or": bson.A{bson.M{"email": login}, bson.M{"username": login}}}
-		err := userCollection.FindOne(ctx, filter).Decode(&foundUser)
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleResetIp, c.ClientIP()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleResetIp, c.ClientIP(), helpers.PasswordResetThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		foundUser, err = findUserByLogin(ctx, login)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "user not found"})
 			return
 		}
 
-		signedEmailToken, err := helpers.GenerateEmailToken(foundUser.Email)
+		// keyed on the account rather than what was typed, so email and username share a budget
+		wait, locked, err = checkThrottle(ctx, throttleKey(throttleResetAccount, foundUser.Id.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+		if _, err = registerFailure(ctx, throttleResetAccount, foundUser.Id.Hex(), helpers.PasswordResetThrottle); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		signedEmailToken, err := helpers.GeneratePasswordResetToken(foundUser.Email)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
@@ -361,7 +530,7 @@ func ResetPassword() gin.HandlerFunc {
 
 		queries := c.Request.URL.Query()
 		pswResetToken := queries.Get("pswResetToken")
-		claims, msg := helpers.ValidateToken(pswResetToken)
+		claims, msg := helpers.ValidateToken(pswResetToken, helpers.PasswordResetToken)
 		if msg != "" {
 			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
 			return
@@ -377,15 +546,30 @@ func ResetPassword() gin.HandlerFunc {
 			return
 		}
 
-		newPassword := helpers.HashPassword(body.NewPassword)
-		updatedAt := time.Now().Unix()
-		updateResult, err := userCollection.UpdateOne(
-			ctx,
-			bson.M{"email": claims.Email},
-			bson.M{"$set": bson.M{"password": newPassword, "updated_at": updatedAt}},
-		)
+		var user models.User
+		if err := userCollection.FindOne(ctx, bson.M{"email": claims.Email}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "user not found"})
+			return
+		}
+
+		if violations := passwordPolicyViolations(user, body.NewPassword); len(violations) > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: violations})
+			return
+		}
+
+		if err := consumeToken(ctx, claims); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
 
+		updateResult, err := setPassword(ctx, user, body.NewPassword)
 		if err != nil {
+			releaseToken(ctx, claims)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = revokeSessions(ctx, bson.M{"user_id": user.Id}, "password reset"); err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
@@ -412,7 +596,17 @@ func ChangePassword() gin.HandlerFunc {
 			return
 		}
 
-		err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user)
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleIp, c.ClientIP()), throttleKey(throttleAccount, userId.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		err = userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
@@ -420,26 +614,360 @@ func ChangePassword() gin.HandlerFunc {
 
 		passwordIsValid, msg := helpers.VerifyPassword(body.OldPassword, user.Password)
 		if passwordIsValid != true {
+			if err = registerLoginFailure(ctx, c, user); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
 			return
 		}
 
-		newPassword := helpers.HashPassword(body.NewPassword)
-		updatedAt := time.Now().Unix()
-		updateResult, err := userCollection.UpdateOne(
+		if err = clearThrottle(ctx, throttleKey(throttleAccount, userId.Hex())); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if violations := passwordPolicyViolations(user, body.NewPassword); len(violations) > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: violations})
+			return
+		}
+
+		updateResult, err := setPassword(ctx, user, body.NewPassword)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if err = revokeSessions(ctx, bson.M{"user_id": userId}, "password changed"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: updateResult})
+	}
+}
+
+// passwordPolicyViolations checks a new password against the policy, including the current
+// and recently used passwords of the user
+func passwordPolicyViolations(user models.User, password string) []string {
+	violations := helpers.Passwords.Check(password, user.Username, user.Email)
+	if helpers.Passwords.HistorySize > 0 && helpers.Passwords.IsReused(password, append([]string{user.Password}, user.PasswordHistory...)) {
+		violations = append(violations, fmt.Sprintf("password must differ from your last %d passwords", helpers.Passwords.HistorySize))
+	}
+	return violations
+}
+
+// setPassword stores the new password and keeps the replaced hash in the history
+func setPassword(ctx context.Context, user models.User, password string) (*mongo.UpdateResult, error) {
+	update := bson.M{"$set": bson.M{"password": helpers.HashPassword(password), "updated_at": time.Now().Unix()}}
+	if helpers.Passwords.HistorySize > 1 {
+		update["$push"] = bson.M{"password_history": bson.M{"$each": bson.A{user.Password}, "$slice": -(helpers.Passwords.HistorySize - 1)}}
+	}
+	return userCollection.UpdateOne(ctx, bson.M{"_id": user.Id}, update)
+}
+
+func RequestEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.EmailChangeDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleIp, c.ClientIP()), throttleKey(throttleAccount, userId.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		if err = userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		passwordIsValid, msg := helpers.VerifyPassword(body.Password, user.Password)
+		if passwordIsValid != true {
+			if err = registerLoginFailure(ctx, c, user); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+			return
+		}
+
+		if body.Email == user.Email {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this is already your email"})
+			return
+		}
+
+		count, err := userCollection.CountDocuments(ctx, bson.M{"email": body.Email})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: "this email already exists"})
+			return
+		}
+
+		// only the latest requested address can be confirmed, older links stop working
+		_, err = userCollection.UpdateOne(
 			ctx,
 			bson.M{"_id": userId},
-			bson.M{"$set": bson.M{"password": newPassword, "updated_at": updatedAt}},
+			bson.M{"$set": bson.M{"pending_email": body.Email, "updated_at": time.Now().Unix()}},
 		)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
 
+		emailChangeToken, err := helpers.GenerateEmailChangeToken(userId.Hex(), body.Email)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
 			return
 		}
-		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: updateResult})
+
+		if err = helpers.SendEmailChangeConfirmationEmail(user.FirstName, body.Email, configs.CLIENT+"/email-change?emailChangeToken="+emailChangeToken); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = helpers.SendEmailChangeNoticeEmail(user.FirstName, user.Email, body.Email); err != nil {
+			log.Println(err)
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: "confirmation link has been sent to " + body.Email})
+	}
+}
+
+func ConfirmEmailChange() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		claims, msg := helpers.ValidateToken(queries.Get("emailChangeToken"), helpers.EmailChangeToken)
+		if msg != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: msg})
+			return
+		}
+		userId, _ := primitive.ObjectIDFromHex(claims.Id)
+
+		count, err := userCollection.CountDocuments(ctx, bson.M{"email": claims.Email})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if count > 0 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this email already exists"})
+			return
+		}
+
+		if err = consumeToken(ctx, claims); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		result, err := userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": userId, "pending_email": claims.Email},
+			bson.M{"$set": bson.M{"email": claims.Email, "pending_email": "", "email_confirmed": true, "updated_at": time.Now().Unix()}},
+		)
+		if err != nil {
+			releaseToken(ctx, claims)
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if result.MatchedCount < 1 {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this email change is no longer pending"})
+			return
+		}
+
+		// access tokens carry the old email, so every session has to sign in again
+		if err = revokeSessions(ctx, bson.M{"user_id": userId}, "email changed"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: claims.Email})
+	}
+}
+
+func DeleteAccount() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.AccountDeleteDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		wait, locked, err := checkThrottle(ctx, throttleKey(throttleIp, c.ClientIP()), throttleKey(throttleAccount, userId.Hex()))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait > 0 {
+			abortThrottled(c, wait, locked)
+			return
+		}
+
+		if err = userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		passwordIsValid, msg := helpers.VerifyPassword(body.Password, user.Password)
+		if passwordIsValid != true {
+			if err = registerLoginFailure(ctx, c, user); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: msg})
+			return
+		}
+
+		if err = deleteUserData(ctx, user); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		clearRefreshCookie(c)
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: userId})
 	}
 }
 
+// deleteUserData removes the user and everything tied to them. Comments stay, because their
+// rates feed the doctor ranking, but lose their author. A doctor profile that has reviews is
+// detached from the account, one without reviews is deleted.
+func deleteUserData(ctx context.Context, user models.User) error {
+	var doctor models.Doctor
+	var applications []models.DoctorApplication
+	var exports []models.DataExport
+
+	err := doctorCollection.FindOne(ctx, bson.M{"user_id": user.Id}).Decode(&doctor)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	if err == nil {
+		reviews, err := commentCollection.CountDocuments(ctx, bson.M{"doctor_id": doctor.Id})
+		if err != nil {
+			return err
+		}
+		if reviews > 0 {
+			_, err = doctorCollection.UpdateOne(
+				ctx,
+				bson.M{"_id": doctor.Id},
+				bson.M{"$set": bson.M{"user_id": primitive.NilObjectID, "updated_at": time.Now().Unix()}},
+			)
+		} else {
+			_, err = doctorCollection.DeleteOne(ctx, bson.M{"_id": doctor.Id})
+			if err == nil && doctor.Img != "" {
+				err = helpers.RemoveAvatar(doctor.Img, helpers.Folders.Doctor)
+			}
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = commentCollection.UpdateMany(
+		ctx,
+		bson.M{"user_id": user.Id},
+		bson.M{"$set": bson.M{"user_id": primitive.NilObjectID}},
+	)
+	if err != nil {
+		return err
+	}
+	_, err = commentCollection.UpdateMany(
+		ctx,
+		bson.M{"likes.user_id": user.Id},
+		bson.M{"$pull": bson.M{"likes": bson.M{"user_id": user.Id}}},
+	)
+	if err != nil {
+		return err
+	}
+
+	cursor, err := doctorApplicationCollection.Find(ctx, bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &applications); err != nil {
+		return err
+	}
+	for _, application := range applications {
+		for _, document := range application.Documents {
+			if err = os.Remove(helpers.DocumentPath(helpers.Folders.Doctor, document)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if _, err = doctorApplicationCollection.DeleteMany(ctx, bson.M{"user_id": user.Id}); err != nil {
+		return err
+	}
+
+	cursor, err = dataExportCollection.Find(ctx, bson.M{"user_id": user.Id})
+	if err != nil {
+		return err
+	}
+	if err = cursor.All(ctx, &exports); err != nil {
+		return err
+	}
+	for _, export := range exports {
+		if export.File == "" {
+			continue
+		}
+		if err = os.Remove(helpers.ExportPath(export.File)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	if _, err = dataExportCollection.DeleteMany(ctx, bson.M{"user_id": user.Id}); err != nil {
+		return err
+	}
+
+	if _, err = sessionCollection.DeleteMany(ctx, bson.M{"user_id": user.Id}); err != nil {
+		return err
+	}
+	if _, err = usernameHistoryCollection.DeleteMany(ctx, bson.M{"user_id": user.Id}); err != nil {
+		return err
+	}
+	if _, err = loginAttemptCollection.DeleteMany(ctx, bson.M{"_id": throttleKey(throttleAccount, user.Id.Hex())}); err != nil {
+		return err
+	}
+
+	if user.Img != "" {
+		if err = helpers.RemoveAvatar(user.Img, helpers.Folders.User); err != nil {
+			return err
+		}
+	}
+
+	_, err = userCollection.DeleteOne(ctx, bson.M{"_id": user.Id})
+	return err
+}
+
 func UploadAvatar() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
@@ -502,3 +1030,134 @@ func UploadAvatar() gin.HandlerFunc {
 		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: fileName})
 	}
 }
+
+var adminUserProjection = bson.M{
+	"first_name":      1,
+	"last_name":       1,
+	"email":           1,
+	"username":        1,
+	"role":            1,
+	"img":             1,
+	"email_confirmed": 1,
+	"contact":         1,
+	"mfa_enabled":     "$mfa.enabled",
+	"created_at":      1,
+	"updated_at":      1,
+}
+
+func AllUsers() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var users []dto.AdminUserResDTO
+		defer cancel()
+
+		queries := c.Request.URL.Query()
+		skip, _ := strconv.ParseInt(queries.Get("skip"), 10, 64)
+		limit, _ := strconv.ParseInt(queries.Get("limit"), 10, 64)
+		if limit <= 0 {
+			limit = 50
+		}
+
+		filter := bson.M{}
+		if role := queries.Get("role"); role != "" {
+			filter["role"] = role
+		}
+		if term := queries.Get("term"); term != "" {
+			pattern := primitive.Regex{Pattern: regexp.QuoteMeta(term), Options: "i"}
+			filter["$or"] = bson.A{bson.M{"email": pattern}, bson.M{"username": pattern}, bson.M{"first_name": pattern}, bson.M{"last_name": pattern}}
+		}
+
+		opts := options.Find().SetProjection(adminUserProjection).SetSort(bson.M{"created_at": -1}).SetSkip(skip).SetLimit(limit)
+		cursor, err := userCollection.Find(ctx, filter, opts)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if err = cursor.All(ctx, &users); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: users})
+	}
+}
+
+func UserById() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var user dto.AdminUserResDTO
+		var lockout models.LoginAttempt
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.Param("userId"))
+
+		opts := options.FindOne().SetProjection(adminUserProjection)
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}, opts).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "user not found"})
+			return
+		}
+
+		err := loginAttemptCollection.FindOne(ctx, bson.M{"_id": throttleKey(throttleAccount, userId.Hex())}).Decode(&lockout)
+		if err == nil {
+			user.Lockout = &lockout
+		} else if err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: user})
+	}
+}
+
+func UpdateUserRole() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.RoleUpdateDTO
+		var user models.User
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.Param("userId"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if userId.Hex() == c.GetString("_id") {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "you cannot change your own role"})
+			return
+		}
+
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := userCollection.FindOneAndUpdate(
+			ctx,
+			bson.M{"_id": userId},
+			bson.M{"$set": bson.M{"role": body.Role, "updated_at": time.Now().Unix()}},
+			opts,
+		).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "user not found"})
+			return
+		}
+
+		// access tokens carry the role, so the old permissions must not outlive this change
+		if err = revokeSessions(ctx, bson.M{"user_id": userId}, "role changed"); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if body.Role == helpers.RoleDoctor {
+			if _, err = createDoctorProfile(ctx, user); err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: user.Role})
+	}
+}
@@ -0,0 +1,195 @@
+package controllers
+
+import (
+	"context"
+	"doctorrank_go/configs"
+	"doctorrank_go/dto"
+	"doctorrank_go/helpers"
+	"doctorrank_go/models"
+	"doctorrank_go/responses"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var usernameHistoryCollection *mongo.Collection = configs.GetCollection(configs.DB, "username_history")
+
+func ChangeUsername() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		var body dto.UsernameDTO
+		var user models.User
+		var lastChange models.UsernameHistory
+		defer cancel()
+
+		userId, _ := primitive.ObjectIDFromHex(c.GetString("_id"))
+
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: err.Error()})
+			return
+		}
+
+		if validationErr := validate.Struct(body); validationErr != nil {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: validationErr.Error()})
+			return
+		}
+
+		if err := userCollection.FindOne(ctx, bson.M{"_id": userId}).Decode(&user); err != nil {
+			c.JSON(http.StatusNotFound, responses.Response{Status: http.StatusNotFound, Message: "error", Data: "user not found"})
+			return
+		}
+
+		if body.Username == user.Username {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: "this is already your username"})
+			return
+		}
+		if reason := helpers.CheckUsername(body.Username); reason != "" {
+			c.JSON(http.StatusBadRequest, responses.Response{Status: http.StatusBadRequest, Message: "error", Data: reason})
+			return
+		}
+
+		now := time.Now().Unix()
+		opts := options.FindOne().SetSort(bson.M{"changed_at": -1})
+		err := usernameHistoryCollection.FindOne(ctx, bson.M{"user_id": user.Id}, opts).Decode(&lastChange)
+		if err != nil && err != mongo.ErrNoDocuments {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if wait := lastChange.ChangedAt + helpers.UsernameCooldownDays*24*60*60 - now; err == nil && wait > 0 {
+			c.Header("Retry-After", strconv.FormatInt(wait, 10))
+			c.JSON(http.StatusTooManyRequests, responses.Response{Status: http.StatusTooManyRequests, Message: "error", Data: fmt.Sprintf("the username can only be changed once every %d days", helpers.UsernameCooldownDays)})
+			return
+		}
+
+		taken, err := usernameTaken(ctx, body.Username, user.Id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, responses.Response{Status: http.StatusConflict, Message: "error", Data: "this username already exists"})
+			return
+		}
+
+		if _, err = userCollection.UpdateOne(
+			ctx,
+			bson.M{"_id": user.Id},
+			bson.M{"$set": bson.M{"username": body.Username, "updated_at": now}},
+		); err != nil {
+			if isUsernameConflict(err) {
+				c.JSON(http.StatusConflict, responses.Response{Status: http.StatusConflict, Message: "error", Data: "this username already exists"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		history := models.UsernameHistory{
+			Id:         primitive.NewObjectID(),
+			UserId:     user.Id,
+			Username:   user.Username,
+			ChangedAt:  now,
+			ReleasedAt: now + helpers.UsernameGraceDays*24*60*60,
+		}
+		if _, err = usernameHistoryCollection.InsertOne(ctx, history); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+		// taking back an old username ends its grace period
+		if _, err = usernameHistoryCollection.UpdateMany(
+			ctx,
+			bson.M{"user_id": user.Id, "username": body.Username, "released_at": bson.M{"$gt": now}},
+			bson.M{"$set": bson.M{"released_at": now}},
+			options.Update().SetCollation(configs.UsernameCollation),
+		); err != nil {
+			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+			return
+		}
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: body.Username})
+	}
+}
+
+func UsernameAvailability() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+		defer cancel()
+
+		username := c.Query("username")
+		availability := dto.UsernameAvailabilityResDTO{Username: username, Reason: helpers.CheckUsername(username)}
+
+		if availability.Reason == "" {
+			taken, err := usernameTaken(ctx, username, primitive.NilObjectID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
+				return
+			}
+			if taken {
+				availability.Reason = "this username already exists"
+			}
+		}
+		availability.Available = availability.Reason == ""
+
+		c.JSON(http.StatusOK, responses.Response{Status: http.StatusOK, Message: "success", Data: availability})
+	}
+}
+
+// usernameTaken reports whether username belongs to another account, either currently or
+// as a former username still within its grace period. Usernames differing only in case are
+// the same username. This is a courtesy check, the unique index on users is what holds when
+// two requests race for a name, see isUsernameConflict.
+func usernameTaken(ctx context.Context, username string, userId primitive.ObjectID) (bool, error) {
+	opts := options.Count().SetCollation(configs.UsernameCollation)
+	count, err := userCollection.CountDocuments(ctx, bson.M{"username": username, "_id": bson.M{"$ne": userId}}, opts)
+	if err != nil || count > 0 {
+		return count > 0, err
+	}
+
+	filter := bson.M{"username": username, "user_id": bson.M{"$ne": userId}, "released_at": bson.M{"$gt": time.Now().Unix()}}
+	count, err = usernameHistoryCollection.CountDocuments(ctx, filter, opts)
+	return count > 0, err
+}
+
+// findUserByLogin resolves what was typed to sign in, an email address or a username in any case
+func findUserByLogin(ctx context.Context, login string) (models.User, error) {
+	var user models.User
+
+	filter := bson.M{"$or": bson.A{bson.M{"email": login}, bson.M{"username": login}}}
+	err := userCollection.FindOne(ctx, filter, options.FindOne().SetCollation(configs.UsernameCollation)).Decode(&user)
+	return user, err
+}
+
+// findUserByUsername also resolves former usernames during their grace period and returns the
+// username that was asked for when it is no longer the current one
+func findUserByUsername(ctx context.Context, username string, filter bson.M) (models.User, string, error) {
+	var user models.User
+	var history models.UsernameHistory
+
+	filter["username"] = username
+	err := userCollection.FindOne(ctx, filter, options.FindOne().SetCollation(configs.UsernameCollation)).Decode(&user)
+	if err != mongo.ErrNoDocuments {
+		return user, "", err
+	}
+
+	opts := options.FindOne().SetSort(bson.M{"changed_at": -1}).SetCollation(configs.UsernameCollation)
+	if err = usernameHistoryCollection.FindOne(ctx, bson.M{"username": username, "released_at": bson.M{"$gt": time.Now().Unix()}}, opts).Decode(&history); err != nil {
+		return user, "", err
+	}
+
+	delete(filter, "username")
+	filter["_id"] = history.UserId
+	err = userCollection.FindOne(ctx, filter).Decode(&user)
+	return user, username, err
+}
+
+// isUsernameConflict reports whether a write failed because another account holds the username
+func isUsernameConflict(err error) bool {
+	return mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "username_unique")
+}
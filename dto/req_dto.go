@@ -15,12 +15,48 @@ type ImageDTO struct {
 	} `form:"coordinates" validate:"json"`
 }
 
+type DoctorApplicationDTO struct {
+	LicenseNumber  string                  `form:"license_number" validate:"required"`
+	IssuingCountry string                  `form:"issuing_country" validate:"required"`
+	DoctorId       string                  `form:"doctor_id"`
+	Documents      []*multipart.FileHeader `form:"documents" validate:"required,min=1,max=5"`
+}
+
+type DoctorApplicationRejectDTO struct {
+	Reason string `bson:"reason" json:"reason" validate:"required"`
+}
+
+type RegistryImportDTO struct {
+	File   *multipart.FileHeader `form:"file" validate:"required"`
+	Format string                `form:"format" validate:"omitempty,oneof=csv json"`
+}
+
+type ActivationResendDTO struct {
+	Email string `bson:"email" json:"email" validate:"required,email"`
+}
+
+type PrivacyDTO struct {
+	HideProfile  bool   `bson:"hide_profile" json:"hide_profile"`
+	UsePseudonym bool   `bson:"use_pseudonym" json:"use_pseudonym"`
+	Pseudonym    string `bson:"pseudonym" json:"pseudonym" validate:"required_if=UsePseudonym true,max=40"`
+}
+
+type ImpersonationDTO struct {
+	Reason string `bson:"reason" json:"reason" validate:"required"`
+}
+
+type ApiKeyDTO struct {
+	Name          string   `bson:"name" json:"name" validate:"required"`
+	Scopes        []string `bson:"scopes" json:"scopes" validate:"required,min=1"`
+	ExpiresInDays int64    `bson:"expires_in_days" json:"expires_in_days" validate:"min=0"`
+}
+
 type RegisterDTO struct {
 	FirstName string `bson:"first_name" json:"first_name" validate:"required"`
 	LastName  string `bson:"last_name" json:"last_name" validate:"required"`
 	Email     string `bson:"email" json:"email" validate:"email,required"`
 	Username  string `bson:"username" json:"username" validate:"required"`
-	Password  string `bson:"password" json:"password" validate:"required,min=8"`
+	Password  string `bson:"password" json:"password" validate:"required"`
 }
 
 type LoginDTO struct {
@@ -29,13 +65,58 @@ type LoginDTO struct {
 	RememberMe bool   `bson:"remember_me" json:"remember_me" validate:"required"`
 }
 
+type MagicLinkDTO struct {
+	Login      string `bson:"login" json:"login" validate:"required"`
+	RememberMe bool   `bson:"remember_me" json:"remember_me"`
+}
+
+type MagicLinkVerifyDTO struct {
+	Token string `bson:"token" json:"token" validate:"required"`
+}
+
+type OauthCallbackDTO struct {
+	Code  string `bson:"code" json:"code" validate:"required"`
+	State string `bson:"state" json:"state" validate:"required"`
+}
+
+type MfaLoginDTO struct {
+	MfaToken string `bson:"mfa_token" json:"mfa_token" validate:"required"`
+	Code     string `bson:"code" json:"code" validate:"required"`
+}
+
+type MfaSetupDTO struct {
+	Password string `bson:"password" json:"password" validate:"required"`
+}
+
+type MfaCodeDTO struct {
+	Code string `bson:"code" json:"code" validate:"required"`
+}
+
+type MfaDisableDTO struct {
+	Password string `bson:"password" json:"password" validate:"required"`
+	Code     string `bson:"code" json:"code" validate:"required"`
+}
+
 type PasswordDTO struct {
 	OldPassword string `bson:"old_password" json:"old_password" validate:"required"`
-	NewPassword string `bson:"new_password" json:"new_password" validate:"required,min=8"`
+	NewPassword string `bson:"new_password" json:"new_password" validate:"required"`
+}
+
+type AccountDeleteDTO struct {
+	Password string `bson:"password" json:"password" validate:"required"`
+}
+
+type UsernameDTO struct {
+	Username string `bson:"username" json:"username" validate:"required"`
+}
+
+type EmailChangeDTO struct {
+	Email    string `bson:"email" json:"email" validate:"required,email"`
+	Password string `bson:"password" json:"password" validate:"required"`
 }
 
 type PasswordResetDTO struct {
-	NewPassword string `bson:"new_password" json:"new_password" validate:"required,min=8"`
+	NewPassword string `bson:"new_password" json:"new_password" validate:"required"`
 }
 
 type UserUpdateDTO struct {
@@ -77,3 +158,11 @@ type DoctorEducationUpdateDTO struct {
 type HospitalDTO struct {
 	Name string `bson:"name" json:"name" validate:"required"`
 }
+
+type ProfessionDTO struct {
+	Name string `bson:"name" json:"name" validate:"required"`
+}
+
+type RoleUpdateDTO struct {
+	Role string `bson:"role" json:"role" validate:"required,oneof=user doctor moderator admin"`
+}
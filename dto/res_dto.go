@@ -2,19 +2,145 @@ package dto
 
 import (
 	"doctorrank_go/models"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type LoginResDTO struct {
+	Id         primitive.ObjectID `bson:"_id" json:"_id"`
+	FirstName  string             `bson:"first_name" json:"first_name"`
+	LastName   string             `bson:"last_name" json:"last_name"`
+	Email      string             `bson:"email" json:"email"`
+	Username   string             `bson:"username" json:"username"`
+	Token      string             `bson:"token" json:"token"`
+	Role       string             `bson:"role" json:"role"`
+	Img        string             `bson:"img" json:"img"`
+	Contact    models.UserContact `bson:"contact" json:"contact"`
+	MfaEnabled bool               `bson:"-" json:"mfa_enabled"`
+	CreatedAt  int64              `bson:"created_at" json:"created_at"`
+	UpdatedAt  int64              `bson:"updated_at" json:"updated_at"`
+}
+
+type MfaRequiredResDTO struct {
+	MfaRequired bool   `bson:"mfa_required" json:"mfa_required"`
+	MfaToken    string `bson:"mfa_token" json:"mfa_token"`
+}
+
+type MfaSetupResDTO struct {
+	Secret          string `bson:"secret" json:"secret"`
+	ProvisioningUri string `bson:"provisioning_uri" json:"provisioning_uri"`
+}
+
+type ActivationStatusResDTO struct {
+	Email             string `bson:"email" json:"email"`
+	EmailConfirmed    bool   `bson:"email_confirmed" json:"email_confirmed"`
+	ResendAvailableIn int64  `bson:"resend_available_in" json:"resend_available_in"`
+}
+
+type UsernameAvailabilityResDTO struct {
+	Username  string `bson:"username" json:"username"`
+	Available bool   `bson:"available" json:"available"`
+	Reason    string `bson:"reason" json:"reason,omitempty"`
+}
+
+type PublicProfileResDTO struct {
+	Username       string   `bson:"username" json:"username"`
+	RedirectedFrom string   `bson:"redirected_from" json:"redirected_from,omitempty"`
+	DisplayName    string   `bson:"display_name" json:"display_name"`
+	Img            string   `bson:"img" json:"img"`
+	ReviewsHidden  bool     `bson:"reviews_hidden" json:"reviews_hidden"`
+	ReviewCount    int64    `bson:"review_count" json:"review_count"`
+	AverageRating  float64  `bson:"average_rating" json:"average_rating"`
+	Reviews        []bson.M `bson:"reviews" json:"reviews"`
+	CreatedAt      int64    `bson:"created_at" json:"created_at"`
+}
+
+type DoctorSearchResDTO struct {
+	Doctors []bson.M           `bson:"doctors" json:"doctors"`
+	Total   int64              `bson:"total" json:"total"`
+	Facets  DoctorFacetsResDTO `bson:"facets" json:"facets"`
+}
+
+type DoctorFacetsResDTO struct {
+	Professions []FacetCountResDTO `bson:"professions" json:"professions"`
+	Hospitals   []FacetCountResDTO `bson:"hospitals" json:"hospitals"`
+}
+
+type FacetCountResDTO struct {
+	Id    primitive.ObjectID `bson:"_id" json:"_id"`
+	Name  string             `bson:"name" json:"name"`
+	Count int64              `bson:"count" json:"count"`
+}
+
+type SuggestionResDTO struct {
+	Type      string             `bson:"type" json:"type"`
 	Id        primitive.ObjectID `bson:"_id" json:"_id"`
-	FirstName string             `bson:"first_name" json:"first_name"`
-	LastName  string             `bson:"last_name" json:"last_name"`
-	Email     string             `bson:"email" json:"email"`
-	Username  string             `bson:"username" json:"username"`
-	Token     string             `bson:"token" json:"token"`
-	Role      string             `bson:"role" json:"role"`
-	Img       string             `bson:"img" json:"img"`
-	Contact   models.UserContact `bson:"contact" json:"contact"`
-	CreatedAt int64              `bson:"created_at" json:"created_at"`
-	UpdatedAt int64              `bson:"updated_at" json:"updated_at"`
+	Name      string             `bson:"name" json:"name"`
+	Title     string             `bson:"title,omitempty" json:"title,omitempty"`
+	Img       string             `bson:"img,omitempty" json:"-"`
+	Thumbnail string             `bson:"thumbnail,omitempty" json:"thumbnail,omitempty"`
+	Rank      float64            `bson:"rank,omitempty" json:"rank,omitempty"`
+	Score     float64            `bson:"score" json:"score"`
+}
+
+type RankingPreviewResDTO struct {
+	Strategy      string                          `bson:"strategy" json:"strategy"`
+	PriorMean     float64                         `bson:"prior_mean" json:"prior_mean"`
+	PriorWeight   float64                         `bson:"prior_weight" json:"prior_weight"`
+	HalfLifeDays  float64                         `bson:"half_life_days" json:"half_life_days"`
+	PositiveStars int                             `bson:"positive_stars" json:"positive_stars"`
+	Rankings      map[string][]RankingPreviewItem `bson:"rankings" json:"rankings"`
+}
+
+type RankingPreviewItem struct {
+	DoctorId        primitive.ObjectID `bson:"doctor_id" json:"doctor_id"`
+	FullName        string             `bson:"full_name" json:"full_name"`
+	Rating          float64            `bson:"rating" json:"rating"`
+	Reviews         int64              `bson:"reviews" json:"reviews"`
+	Score           float64            `bson:"score" json:"score"`
+	Position        int                `bson:"position" json:"position"`
+	CurrentPosition int                `bson:"current_position" json:"current_position"`
+}
+
+type ImpersonationResDTO struct {
+	Token         string               `bson:"token" json:"token"`
+	Impersonation models.Impersonation `bson:"impersonation" json:"impersonation"`
+}
+
+type ApiKeyResDTO struct {
+	Key    string        `bson:"key" json:"key"`
+	ApiKey models.ApiKey `bson:"api_key" json:"api_key"`
+}
+
+type SessionResDTO struct {
+	Id              primitive.ObjectID `bson:"_id" json:"_id"`
+	UserAgent       string             `bson:"user_agent" json:"user_agent"`
+	Ip              string             `bson:"ip" json:"ip"`
+	CreatedAt       int64              `bson:"created_at" json:"created_at"`
+	LastRefreshedAt int64              `bson:"last_refreshed_at" json:"last_refreshed_at"`
+	ExpiresAt       int64              `bson:"expires_at" json:"expires_at"`
+	Current         bool               `bson:"current" json:"current"`
+}
+
+type AdminUserResDTO struct {
+	Id             primitive.ObjectID   `bson:"_id" json:"_id"`
+	FirstName      string               `bson:"first_name" json:"first_name"`
+	LastName       string               `bson:"last_name" json:"last_name"`
+	Email          string               `bson:"email" json:"email"`
+	Username       string               `bson:"username" json:"username"`
+	Role           string               `bson:"role" json:"role"`
+	Img            string               `bson:"img" json:"img"`
+	EmailConfirmed bool                 `bson:"email_confirmed" json:"email_confirmed"`
+	Contact        models.UserContact   `bson:"contact" json:"contact"`
+	MfaEnabled     bool                 `bson:"mfa_enabled" json:"mfa_enabled"`
+	Lockout        *models.LoginAttempt `bson:"lockout,omitempty" json:"lockout,omitempty"`
+	CreatedAt      int64                `bson:"created_at" json:"created_at"`
+	UpdatedAt      int64                `bson:"updated_at" json:"updated_at"`
+}
+
+type RegistryImportResDTO struct {
+	Inserted            int64 `bson:"inserted" json:"inserted"`
+	Updated             int64 `bson:"updated" json:"updated"`
+	MatchedApplications int64 `bson:"matched_applications" json:"matched_applications"`
+	MatchedDoctors      int64 `bson:"matched_doctors" json:"matched_doctors"`
 }
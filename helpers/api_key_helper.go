@@ -0,0 +1,28 @@
+package helpers
+
+const (
+	ScopeDoctorsRead     = "doctors:read"
+	ScopeCommentsRead    = "comments:read"
+	ScopeHospitalsRead   = "hospitals:read"
+	ScopeProfessionsRead = "professions:read"
+)
+
+var ApiKeyScopes = []string{ScopeDoctorsRead, ScopeCommentsRead, ScopeHospitalsRead, ScopeProfessionsRead}
+
+func IsApiKeyScope(scope string) bool {
+	for _, apiKeyScope := range ApiKeyScopes {
+		if scope == apiKeyScope {
+			return true
+		}
+	}
+	return false
+}
+
+const apiKeyPrefix = "drk_"
+
+// GenerateApiKey returns a new key in plain text. Only its HashToken digest is stored, the
+// first characters are kept as prefix so admins can tell keys apart.
+func GenerateApiKey() (key string, prefix string) {
+	key = apiKeyPrefix + RandomToken(24)
+	return key, key[:len(apiKeyPrefix)+8]
+}
@@ -0,0 +1,42 @@
+package helpers
+
+import (
+	"doctorrank_go/configs"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const MaxDocumentBytes = 10 << 20
+
+var allowedDocumentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+}
+
+// SaveDocument stores an uploaded document in a folder that is not served statically
+func SaveDocument(buffer []byte, name string, directory string) (string, error) {
+	if len(buffer) > MaxDocumentBytes {
+		return "", errors.New("document is larger than 10MB")
+	}
+	extension, ok := allowedDocumentTypes[http.DetectContentType(buffer)]
+	if !ok {
+		return "", errors.New("only pdf, jpeg and png documents are accepted")
+	}
+
+	filename := name + extension
+	folder := filepath.Join(configs.Env("FILESYSTEM_PATH"), directory, "documents")
+	if err := os.MkdirAll(folder, 0750); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(folder, filename), buffer, 0640); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+func DocumentPath(directory string, filename string) string {
+	return filepath.Join(configs.Env("FILESYSTEM_PATH"), directory, "documents", filepath.Base(filename))
+}
@@ -3,6 +3,7 @@ package helpers
 import (
 	"doctorrank_go/configs"
 	mail "github.com/xhit/go-simple-mail/v2"
+	"html"
 	"strconv"
 	"sync"
 )
@@ -56,6 +57,104 @@ func SendPasswordResetEmail(emailAddress, link string) error {
 	return err
 }
 
+func SendAccountLockedEmail(emailAddress, link string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Account Locked")
+	email.SetBody(mail.TextHTML, getAccountLockedHtml(link))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendDoctorApplicationApprovedEmail(name, emailAddress, link string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Doctor Application Approved")
+	email.SetBody(mail.TextHTML, getDoctorApplicationApprovedHtml(name, link))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendDoctorApplicationRejectedEmail(name, emailAddress, reason string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Doctor Application Rejected")
+	email.SetBody(mail.TextHTML, getDoctorApplicationRejectedHtml(name, reason))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendEmailChangeConfirmationEmail(name, emailAddress, link string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Confirm Your New Email")
+	email.SetBody(mail.TextHTML, getEmailChangeConfirmationHtml(name, link))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendEmailChangeNoticeEmail(name, emailAddress, newEmailAddress string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Email Change Requested")
+	email.SetBody(mail.TextHTML, getEmailChangeNoticeHtml(name, newEmailAddress))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendDataExportEmail(name, emailAddress, link string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Your Data Export Is Ready")
+	email.SetBody(mail.TextHTML, getDataExportHtml(name, link))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
+func SendMagicLinkEmail(name, emailAddress, link string) error {
+	smtpClient, err := SmtpClient()
+	// Create email
+	email := mail.NewMSG()
+	email.SetFrom("Doctorrank <" + configs.MAIL_SERVER_EMAIL_FROM + ">")
+	email.AddTo(emailAddress)
+	email.SetSubject("Sign In to Doctorrank")
+	email.SetBody(mail.TextHTML, getMagicLinkHtml(name, link))
+
+	// Send email
+	err = email.Send(smtpClient)
+	return err
+}
+
 func getHtml(name, link string) string {
 	htmlBody := `
 		<!DOCTYPE html>
@@ -107,7 +206,38 @@ func getPasswordResetHtml(link string) string {
 			<h1>Reset password!</h1>
 			<p>Please follow the link below to reset your password.</p>
 			<a href="` + link + `" class="btn-activate" target="_blank">RESET PASSWORD</a>
-		    <p>The link will expire within 24 hours.</p>
+		    <p>The link will expire within ` + linkLifetime(PasswordResetMinutes) + `.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getAccountLockedHtml(link string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+			<style>
+		        .btn-activate {
+		            background-color: red;
+		            padding: 10px 20px;
+		            color: white;
+		            border-radius: 4px;
+		            font-weight: 600;
+		        }
+		    </style>
+		</head>
+		<body>
+			<h1>Your account has been locked</h1>
+			<p>We noticed too many failed sign-in attempts and temporarily locked your account.</p>
+			<p>If this was you, follow the link below to unlock it now. If it was not, consider changing your password.</p>
+			<a href="` + link + `" class="btn-activate" target="_blank">UNLOCK ACCOUNT</a>
+		    <p>The link will expire within ` + linkLifetime(UnlockLinkMinutes) + `.</p>
 		    <br>
 		    <p>Regards,<br>Doctorrank team</p>
 		</body>
@@ -115,3 +245,181 @@ func getPasswordResetHtml(link string) string {
 	`
 	return htmlBody
 }
+
+func getDoctorApplicationApprovedHtml(name, link string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+			<style>
+		        .btn-activate {
+		            background-color: red;
+		            padding: 10px 20px;
+		            color: white;
+		            border-radius: 4px;
+		            font-weight: 600;
+		        }
+		    </style>
+		</head>
+		<body>
+			<h1>Congratulations ` + html.EscapeString(name) + ` !</h1>
+			<p>Your doctor application has been approved. You can now complete your public profile.</p>
+			<a href="` + link + `" class="btn-activate" target="_blank">OPEN PROFILE</a>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getDoctorApplicationRejectedHtml(name, reason string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+		</head>
+		<body>
+			<h1>Hello ` + html.EscapeString(name) + `,</h1>
+			<p>Unfortunately your doctor application has been rejected for the following reason:</p>
+			<blockquote>` + html.EscapeString(reason) + `</blockquote>
+			<p>You are welcome to submit a new application with updated documents.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getEmailChangeConfirmationHtml(name, link string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+			<style>
+		        .btn-activate {
+		            background-color: red;
+		            padding: 10px 20px;
+		            color: white;
+		            border-radius: 4px;
+		            font-weight: 600;
+		        }
+		    </style>
+		</head>
+		<body>
+			<h1>Hello ` + html.EscapeString(name) + `,</h1>
+			<p>Please confirm that you want to use this address to sign in to Doctorrank.</p>
+			<a href="` + link + `" class="btn-activate" target="_blank">CONFIRM EMAIL</a>
+		    <p>The link will expire within ` + linkLifetime(EmailChangeMinutes) + `. Your current email stays in use until you confirm.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getEmailChangeNoticeHtml(name, newEmailAddress string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+		</head>
+		<body>
+			<h1>Hello ` + html.EscapeString(name) + `,</h1>
+			<p>A request was made to change the sign-in email of your Doctorrank account to ` + html.EscapeString(newEmailAddress) + `.</p>
+			<p>Nothing changes until the new address is confirmed. If this was not you, change your password right away.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getDataExportHtml(name, link string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+			<style>
+		        .btn-activate {
+		            background-color: red;
+		            padding: 10px 20px;
+		            color: white;
+		            border-radius: 4px;
+		            font-weight: 600;
+		        }
+		    </style>
+		</head>
+		<body>
+			<h1>Hello ` + html.EscapeString(name) + `,</h1>
+			<p>The copy of your Doctorrank data you requested is ready.</p>
+			<a href="` + link + `" class="btn-activate" target="_blank">DOWNLOAD DATA</a>
+		    <p>The link will expire within 7 days. Keep the archive somewhere safe, it contains your personal data.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+func getMagicLinkHtml(name, link string) string {
+	htmlBody := `
+		<!DOCTYPE html>
+		<html>
+		<head>
+		    <meta http-equiv="Content-type" content="text/html" charset="UTF-8">
+		    <title>Document</title>
+			<style>
+		        .btn-activate {
+		            background-color: red;
+		            padding: 10px 20px;
+		            color: white;
+		            border-radius: 4px;
+		            font-weight: 600;
+		        }
+		    </style>
+		</head>
+		<body>
+			<h1>Hello ` + html.EscapeString(name) + `,</h1>
+			<p>Follow the link below to sign in to Doctorrank, no password needed.</p>
+			<a href="` + link + `" class="btn-activate" target="_blank">SIGN IN</a>
+		    <p>The link works only once and expires within 15 minutes. If you did not ask for it, you can ignore this email.</p>
+		    <br>
+		    <p>Regards,<br>Doctorrank team</p>
+		</body>
+		</html>	
+	`
+	return htmlBody
+}
+
+// linkLifetime spells out how long a link signed for the given number of minutes stays valid
+func linkLifetime(minutes int64) string {
+	switch {
+	case minutes%(24*60) == 0 && minutes >= 24*60:
+		return plural(minutes/(24*60), "day")
+	case minutes%60 == 0 && minutes >= 60:
+		return plural(minutes/60, "hour")
+	}
+	return plural(minutes, "minute")
+}
+
+func plural(count int64, unit string) string {
+	if count == 1 {
+		return "1 " + unit
+	}
+	return strconv.FormatInt(count, 10) + " " + unit + "s"
+}
@@ -0,0 +1,79 @@
+package helpers
+
+import (
+	"archive/zip"
+	"doctorrank_go/configs"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// ExportLinkMinutes is how long a finished data export can be downloaded
+const ExportLinkMinutes = 7 * 24 * 60
+
+// ExportBuildMinutes is how long an export may stay pending before it is given up, e.g. after
+// the process building it was restarted
+const ExportBuildMinutes = 30
+
+// ExportCleanupMinutes is how often abandoned exports and expired archives are cleaned up
+const ExportCleanupMinutes = 60
+
+func ExportPath(filename string) string {
+	return filepath.Join(configs.Env("FILESYSTEM_PATH"), "exports", filepath.Base(filename))
+}
+
+// WriteExportArchive zips every document as indented JSON next to copies of the given files.
+// Files that no longer exist on disk are skipped.
+func WriteExportArchive(filename string, documents map[string]interface{}, files map[string]string) error {
+	path := ExportPath(filename)
+	if err := os.MkdirAll(filepath.Dir(path), 0750); err != nil {
+		return err
+	}
+
+	archive, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	writer := zip.NewWriter(archive)
+	for name, document := range documents {
+		content, err := json.MarshalIndent(document, "", "  ")
+		if err != nil {
+			return err
+		}
+		entry, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err = entry.Write(content); err != nil {
+			return err
+		}
+	}
+
+	for name, source := range files {
+		if err = copyIntoArchive(writer, name, source); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+
+	return writer.Close()
+}
+
+func copyIntoArchive(writer *zip.Writer, name string, source string) error {
+	file, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	entry, err := writer.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(entry, file)
+	return err
+}
@@ -2,7 +2,11 @@ package helpers
 
 import (
 	"doctorrank_go/configs"
+	"errors"
 	"github.com/h2non/bimg"
+	"io/fs"
+	"os"
+	"path/filepath"
 	"strconv"
 	"time"
 )
@@ -54,3 +58,15 @@ func ProcessAndSaveAvatar(buffer []byte, name string, directory string, top int,
 
 	return filename, nil
 }
+
+// RemoveAvatar deletes both sizes of an avatar saved by ProcessAndSaveAvatar
+func RemoveAvatar(filename string, directory string) error {
+	path := configs.Env("FILESYSTEM_PATH")
+	for _, size := range []string{"avatar", "thumbnail"} {
+		err := os.Remove(filepath.Join(path, directory, size, filepath.Base(filename)))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,240 @@
+package helpers
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"doctorrank_go/configs"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var SigningMethodEdDSA = &signingMethodEdDSA{}
+
+func init() {
+	jwt.RegisterSigningMethod(SigningMethodEdDSA.Alg(), func() jwt.SigningMethod {
+		return SigningMethodEdDSA
+	})
+}
+
+// signingMethodEdDSA adds Ed25519 support, which jwt-go v3 does not ship
+type signingMethodEdDSA struct{}
+
+func (m *signingMethodEdDSA) Alg() string {
+	return "EdDSA"
+}
+
+func (m *signingMethodEdDSA) Verify(signingString, signature string, key interface{}) error {
+	publicKey, ok := key.(ed25519.PublicKey)
+	if !ok {
+		return jwt.ErrInvalidKeyType
+	}
+	sig, err := jwt.DecodeSegment(signature)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(publicKey, []byte(signingString), sig) {
+		return jwt.ErrSignatureInvalid
+	}
+	return nil
+}
+
+func (m *signingMethodEdDSA) Sign(signingString string, key interface{}) (string, error) {
+	privateKey, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return "", jwt.ErrInvalidKeyType
+	}
+	return jwt.EncodeSegment(ed25519.Sign(privateKey, []byte(signingString))), nil
+}
+
+type SigningKey struct {
+	Kid        string
+	Method     jwt.SigningMethod
+	PrivateKey crypto.PrivateKey
+	PublicKey  crypto.PublicKey
+}
+
+type Keyring struct {
+	signing *SigningKey
+	keys    map[string]*SigningKey
+}
+
+type Jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type Jwks struct {
+	Keys []Jwk `json:"keys"`
+}
+
+var Keys = loadKeyring()
+
+// loadKeyring reads every <kid>.pem file in JWT_KEYS_DIR. Private keys can sign and verify,
+// public keys only verify, which lets a retired key keep validating tokens until they expire.
+// Without a key directory tokens fall back to HS256 with SECRET_KEY.
+func loadKeyring() *Keyring {
+	keyring := &Keyring{keys: map[string]*SigningKey{}}
+	directory := configs.Env("JWT_KEYS_DIR")
+
+	if directory == "" {
+		log.Println("JWT_KEYS_DIR is not set, signing tokens with HS256")
+		keyring.signing = &SigningKey{Kid: "", Method: jwt.SigningMethodHS256, PrivateKey: []byte(SecretKey), PublicKey: []byte(SecretKey)}
+		keyring.keys[""] = keyring.signing
+		return keyring
+	}
+
+	files, err := filepath.Glob(filepath.Join(directory, "*.pem"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range files {
+		key, err := readSigningKey(file)
+		if err != nil {
+			log.Fatal(fmt.Errorf("%s: %w", file, err))
+		}
+		if existing, ok := keyring.keys[key.Kid]; ok && existing.PrivateKey != nil {
+			continue
+		}
+		keyring.keys[key.Kid] = key
+	}
+
+	activeKid := configs.Env("JWT_ACTIVE_KID")
+	if activeKid == "" {
+		kids := keyring.Kids()
+		for i := len(kids) - 1; i >= 0 && activeKid == ""; i-- {
+			if keyring.keys[kids[i]].PrivateKey != nil {
+				activeKid = kids[i]
+			}
+		}
+	}
+	signing, ok := keyring.keys[activeKid]
+	if !ok || signing.PrivateKey == nil {
+		log.Fatal("no private signing key found in JWT_KEYS_DIR for kid \"" + activeKid + "\"")
+	}
+	keyring.signing = signing
+
+	return keyring
+}
+
+func readSigningKey(file string) (*SigningKey, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	key := &SigningKey{Kid: strings.TrimSuffix(strings.TrimSuffix(filepath.Base(file), ".pem"), ".pub")}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key.PublicKey, err = x509.ParsePKIXPublicKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key.PrivateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key.PrivateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		err = errors.New("unsupported PEM block " + block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch privateKey := key.PrivateKey.(type) {
+	case *rsa.PrivateKey:
+		key.PublicKey = &privateKey.PublicKey
+	case ed25519.PrivateKey:
+		key.PublicKey = privateKey.Public()
+	}
+
+	switch key.PublicKey.(type) {
+	case *rsa.PublicKey:
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = SigningMethodEdDSA
+	default:
+		return nil, errors.New("only RSA and Ed25519 keys are supported")
+	}
+
+	return key, nil
+}
+
+// Kids lists the key ids in the keyring in lexical order
+func (k *Keyring) Kids() []string {
+	kids := make([]string, 0, len(k.keys))
+	for kid := range k.keys {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+	return kids
+}
+
+func (k *Keyring) Sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.Method, claims)
+	if k.signing.Kid != "" {
+		token.Header["kid"] = k.signing.Kid
+	}
+	return token.SignedString(k.signing.PrivateKey)
+}
+
+// VerificationKey is a jwt.Keyfunc resolving the key named by the token's kid header
+func (k *Keyring) VerificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key, ok := k.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+	return key.PublicKey, nil
+}
+
+// Jwks publishes the public half of every asymmetric key in the keyring
+func (k *Keyring) Jwks() Jwks {
+	jwks := Jwks{Keys: []Jwk{}}
+	for _, kid := range k.Kids() {
+		key := k.keys[kid]
+		switch publicKey := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, Jwk{
+				Kty: "RSA",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, Jwk{
+				Kty: "OKP",
+				Kid: kid,
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+	return jwks
+}
@@ -0,0 +1,347 @@
+package helpers
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"doctorrank_go/configs"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	jwt "github.com/dgrijalva/jwt-go"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OidcProvider is an OpenID Connect provider configured through the environment:
+//
+//	OIDC_PROVIDERS=google,local
+//	OIDC_GOOGLE_ISSUER, OIDC_GOOGLE_CLIENT_ID, OIDC_GOOGLE_CLIENT_SECRET,
+//	OIDC_GOOGLE_REDIRECT_URI and optionally OIDC_GOOGLE_SCOPES
+type OidcProvider struct {
+	Name         string
+	Issuer       string
+	ClientId     string
+	ClientSecret string
+	RedirectUri  string
+	Scopes       []string
+
+	mutex     sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+	fetchedAt time.Time
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+// IdTokenClaims are the verified claims of an ID token the login flow relies on
+type IdTokenClaims struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	GivenName     string
+	FamilyName    string
+	Name          string
+}
+
+const OidcStateMinutes = 10
+const oidcCacheMinutes = 60
+
+var OidcProviders = loadOidcProviders()
+
+var oidcClient = &http.Client{Timeout: 10 * time.Second}
+
+func loadOidcProviders() map[string]*OidcProvider {
+	providers := map[string]*OidcProvider{}
+	for _, name := range strings.Split(configs.Env("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := &OidcProvider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(configs.Env(prefix+"ISSUER"), "/"),
+			ClientId:     configs.Env(prefix + "CLIENT_ID"),
+			ClientSecret: configs.Env(prefix + "CLIENT_SECRET"),
+			RedirectUri:  configs.Env(prefix + "REDIRECT_URI"),
+			Scopes:       strings.Fields(configs.Env(prefix + "SCOPES")),
+		}
+		if len(provider.Scopes) == 0 {
+			provider.Scopes = []string{"openid", "email", "profile"}
+		}
+		providers[name] = provider
+	}
+	return providers
+}
+
+// PkceChallenge derives the S256 code challenge sent with the authorization request
+func PkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func (p *OidcProvider) AuthorizationUrl(state string, nonce string, verifier string) (string, error) {
+	discovery, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", p.ClientId)
+	query.Set("redirect_uri", p.RedirectUri)
+	query.Set("scope", strings.Join(p.Scopes, " "))
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", PkceChallenge(verifier))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// ExchangeCode redeems an authorization code and returns the raw ID token
+func (p *OidcProvider) ExchangeCode(code string, verifier string) (string, error) {
+	var body struct {
+		IdToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+
+	discovery, err := p.metadata()
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectUri)
+	form.Set("client_id", p.ClientId)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	response, err := oidcClient.PostForm(discovery.TokenEndpoint, form)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+
+	if err = json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return "", err
+	}
+	if response.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("token exchange failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IdToken == "" {
+		return "", errors.New("the provider did not return an id token")
+	}
+	return body.IdToken, nil
+}
+
+// VerifyIdToken checks the signature against the provider's JWKS as well as issuer, audience,
+// expiry and nonce of an ID token
+func (p *OidcProvider) VerifyIdToken(idToken string, nonce string) (IdTokenClaims, error) {
+	var claims IdTokenClaims
+
+	discovery, err := p.metadata()
+	if err != nil {
+		return claims, err
+	}
+
+	token, err := jwt.ParseWithClaims(idToken, jwt.MapClaims{}, p.verificationKey)
+	if err != nil {
+		return claims, err
+	}
+	mapClaims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid {
+		return claims, errors.New("the id token is invalid")
+	}
+
+	if !mapClaims.VerifyIssuer(discovery.Issuer, true) {
+		return claims, errors.New("the id token was issued by another issuer")
+	}
+	if !audienceContains(mapClaims["aud"], p.ClientId) {
+		return claims, errors.New("the id token was issued for another client")
+	}
+	if !mapClaims.VerifyExpiresAt(time.Now().Unix(), true) {
+		return claims, errors.New("the id token is expired")
+	}
+	if tokenNonce, _ := mapClaims["nonce"].(string); tokenNonce != nonce {
+		return claims, errors.New("the id token nonce does not match")
+	}
+
+	claims.Subject, _ = mapClaims["sub"].(string)
+	claims.Email, _ = mapClaims["email"].(string)
+	claims.GivenName, _ = mapClaims["given_name"].(string)
+	claims.FamilyName, _ = mapClaims["family_name"].(string)
+	claims.Name, _ = mapClaims["name"].(string)
+	switch verified := mapClaims["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified = verified == "true"
+	}
+	if claims.Subject == "" {
+		return claims, errors.New("the id token has no subject")
+	}
+
+	return claims, nil
+}
+
+func audienceContains(aud interface{}, clientId string) bool {
+	switch aud := aud.(type) {
+	case string:
+		return aud == clientId
+	case []interface{}:
+		for _, value := range aud {
+			if value == clientId {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *OidcProvider) verificationKey(token *jwt.Token) (interface{}, error) {
+	switch token.Method.(type) {
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodECDSA:
+	default:
+		return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	key, err := p.key(kid, false)
+	if err == nil && key == nil {
+		// the provider may have rotated its keys since they were cached
+		key, err = p.key(kid, true)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+func (p *OidcProvider) metadata() (*oidcDiscovery, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.refresh(false); err != nil {
+		return nil, err
+	}
+	return p.discovery, nil
+}
+
+func (p *OidcProvider) key(kid string, force bool) (interface{}, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if err := p.refresh(force); err != nil {
+		return nil, err
+	}
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, nil
+		}
+	}
+	return p.keys[kid], nil
+}
+
+// refresh loads the discovery document and JWKS, cached for an hour. Callers hold the mutex.
+func (p *OidcProvider) refresh(force bool) error {
+	if !force && p.discovery != nil && time.Since(p.fetchedAt) < oidcCacheMinutes*time.Minute {
+		return nil
+	}
+
+	var discovery oidcDiscovery
+	if err := getJson(p.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return err
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != p.Issuer {
+		return errors.New("the discovery document belongs to another issuer")
+	}
+
+	var jwks struct {
+		Keys []Jwk `json:"keys"`
+	}
+	if err := getJson(discovery.JwksUri, &jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		if key, err := jwk.publicKey(); err == nil {
+			keys[jwk.Kid] = key
+		}
+	}
+
+	p.discovery = &discovery
+	p.keys = keys
+	p.fetchedAt = time.Now()
+	return nil
+}
+
+func getJson(address string, target interface{}) error {
+	response, err := oidcClient.Get(address)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s answered with %d", address, response.StatusCode)
+	}
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func (j Jwk) publicKey() (interface{}, error) {
+	switch j.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(j.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(j.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		if j.Crv != "P-256" {
+			return nil, errors.New("unsupported curve " + j.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(j.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(j.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, errors.New("unsupported key type " + j.Kty)
+}
@@ -0,0 +1,170 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"doctorrank_go/configs"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// PasswordPolicy is configured through the environment:
+//
+//	PASSWORD_MIN_LENGTH       minimum number of characters, 8 by default
+//	PASSWORD_REQUIRE_CLASSES  any of "upper,lower,digit,symbol", all but symbol by default
+//	PASSWORD_HISTORY          number of previous passwords that may not be reused, 3 by default
+//	PASSWORD_BREACHED_LIST    file with one SHA-1 hash (optionally "HASH:COUNT") or password per line
+type PasswordPolicy struct {
+	MinLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	HistorySize    int
+	BreachedList   string
+	breachedOnce   sync.Once
+	breachedHashes map[string]map[string]bool
+}
+
+var Passwords = loadPasswordPolicy()
+
+func loadPasswordPolicy() *PasswordPolicy {
+	policy := &PasswordPolicy{MinLength: 8, HistorySize: 3, BreachedList: configs.Env("PASSWORD_BREACHED_LIST")}
+
+	if minLength, err := strconv.Atoi(configs.Env("PASSWORD_MIN_LENGTH")); err == nil && minLength > 0 {
+		policy.MinLength = minLength
+	}
+	if historySize, err := strconv.Atoi(configs.Env("PASSWORD_HISTORY")); err == nil && historySize >= 0 {
+		policy.HistorySize = historySize
+	}
+
+	classes := "upper,lower,digit"
+	if value, ok := os.LookupEnv("PASSWORD_REQUIRE_CLASSES"); ok {
+		classes = value
+	}
+	for _, class := range strings.Split(classes, ",") {
+		switch strings.TrimSpace(class) {
+		case "upper":
+			policy.RequireUpper = true
+		case "lower":
+			policy.RequireLower = true
+		case "digit":
+			policy.RequireDigit = true
+		case "symbol":
+			policy.RequireSymbol = true
+		}
+	}
+
+	return policy
+}
+
+// Check returns one message per rule the password breaks. Reuse of earlier passwords needs
+// the stored hashes and is checked with IsReused.
+func (p *PasswordPolicy) Check(password string, username string, email string) []string {
+	var violations []string
+	var upper, lower, digit, symbol bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			symbol = true
+		}
+	}
+
+	if len([]rune(password)) < p.MinLength {
+		violations = append(violations, fmt.Sprintf("password must be at least %d characters long", p.MinLength))
+	}
+	if p.RequireUpper && !upper {
+		violations = append(violations, "password must contain an uppercase letter")
+	}
+	if p.RequireLower && !lower {
+		violations = append(violations, "password must contain a lowercase letter")
+	}
+	if p.RequireDigit && !digit {
+		violations = append(violations, "password must contain a digit")
+	}
+	if p.RequireSymbol && !symbol {
+		violations = append(violations, "password must contain a symbol")
+	}
+
+	lowered := strings.ToLower(password)
+	if username != "" && len(username) >= 3 && strings.Contains(lowered, strings.ToLower(username)) {
+		violations = append(violations, "password must not contain your username")
+	}
+	if local := strings.Split(strings.ToLower(email), "@")[0]; len(local) >= 3 && strings.Contains(lowered, local) {
+		violations = append(violations, "password must not contain your email address")
+	}
+
+	if p.IsBreached(password) {
+		violations = append(violations, "password has appeared in a data breach, choose another one")
+	}
+
+	return violations
+}
+
+// IsReused reports whether password matches any of the given bcrypt hashes
+func (p *PasswordPolicy) IsReused(password string, hashes []string) bool {
+	for _, hash := range hashes {
+		if ok, _ := VerifyPassword(password, hash); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// IsBreached looks the password up the way the Pwned Passwords range API works: the list is
+// indexed by the first five hex characters of the SHA-1 hash and only the suffixes within that
+// range are compared
+func (p *PasswordPolicy) IsBreached(password string) bool {
+	p.breachedOnce.Do(p.loadBreachedList)
+
+	sum := sha1.Sum([]byte(password))
+	hash := strings.ToUpper(hex.EncodeToString(sum[:]))
+	return p.breachedHashes[hash[:5]][hash[5:]]
+}
+
+func (p *PasswordPolicy) loadBreachedList() {
+	p.breachedHashes = map[string]map[string]bool{}
+	if p.BreachedList == "" {
+		return
+	}
+
+	file, err := os.Open(p.BreachedList)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		hash := strings.ToUpper(strings.SplitN(line, ":", 2)[0])
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 40 {
+			sum := sha1.Sum([]byte(line))
+			hash = strings.ToUpper(hex.EncodeToString(sum[:]))
+		}
+		if p.breachedHashes[hash[:5]] == nil {
+			p.breachedHashes[hash[:5]] = map[string]bool{}
+		}
+		p.breachedHashes[hash[:5]][hash[5:]] = true
+	}
+	if err = scanner.Err(); err != nil {
+		log.Println(err)
+	}
+}
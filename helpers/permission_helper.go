@@ -0,0 +1,65 @@
+package helpers
+
+type Permission string
+
+const (
+	RoleUser      = "user"
+	RoleDoctor    = "doctor"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+const (
+	PermissionEditDoctorProfile  Permission = "doctor_profile:edit"
+	PermissionCreateHospitals    Permission = "hospitals:create"
+	PermissionCreateProfessions  Permission = "professions:create"
+	PermissionModerateComments   Permission = "comments:moderate"
+	PermissionManageUsers        Permission = "users:manage"
+	PermissionManageDoctors      Permission = "doctors:manage"
+	PermissionManageHospitals    Permission = "hospitals:manage"
+	PermissionManageProfessions  Permission = "professions:manage"
+	PermissionManageLockouts     Permission = "lockouts:manage"
+	PermissionReviewApplications Permission = "doctor_applications:review"
+	PermissionManageApiKeys      Permission = "api_keys:manage"
+	PermissionImpersonateUsers   Permission = "users:impersonate"
+)
+
+var RolePermissions = map[string][]Permission{
+	RoleUser: {},
+	RoleDoctor: {
+		PermissionEditDoctorProfile,
+		PermissionCreateHospitals,
+		PermissionCreateProfessions,
+	},
+	RoleModerator: {
+		PermissionModerateComments,
+	},
+	RoleAdmin: {
+		PermissionEditDoctorProfile,
+		PermissionCreateHospitals,
+		PermissionCreateProfessions,
+		PermissionModerateComments,
+		PermissionManageUsers,
+		PermissionManageDoctors,
+		PermissionManageHospitals,
+		PermissionManageProfessions,
+		PermissionManageLockouts,
+		PermissionReviewApplications,
+		PermissionManageApiKeys,
+		PermissionImpersonateUsers,
+	},
+}
+
+func ValidRole(role string) bool {
+	_, ok := RolePermissions[role]
+	return ok
+}
+
+func HasPermission(role string, permission Permission) bool {
+	for _, granted := range RolePermissions[role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,135 @@
+package helpers
+
+import (
+	"doctorrank_go/configs"
+	"doctorrank_go/models"
+	"math"
+	"strconv"
+)
+
+const (
+	RankBayesian = "bayesian"
+	RankWilson   = "wilson"
+	RankRecency  = "recency"
+)
+
+// RankParams tune the ranking strategies, configured through the environment:
+//
+//	RANK_STRATEGY          strategy behind the default listing order, bayesian by default
+//	RANK_PRIOR_WEIGHT      number of average reviews every doctor starts with, 10 by default
+//	RANK_HALF_LIFE_DAYS    age at which a review counts half for the recency strategy, 180 by default
+//	RANK_POSITIVE_STARS    lowest rate counted as positive by the wilson strategy, 4 by default
+type RankParams struct {
+	Strategy      string
+	PriorMean     float64
+	PriorWeight   float64
+	HalfLifeDays  float64
+	PositiveStars int
+}
+
+// RankStrategy scores a doctor, higher scores are listed first
+type RankStrategy func(rating models.DoctorRating, params RankParams, now int64) float64
+
+var RankStrategies = map[string]RankStrategy{
+	RankBayesian: BayesianRank,
+	RankWilson:   WilsonRank,
+	RankRecency:  RecencyRank,
+}
+
+var RankConfig = loadRankConfig()
+
+// RatingRecomputeMinutes is how often the stored doctor ratings are rebuilt from the comments
+// to correct drift of the incremental updates, RATING_RECOMPUTE_MINUTES overrides the hour
+var RatingRecomputeMinutes = ratingRecomputeMinutes()
+
+func loadRankConfig() RankParams {
+	params := RankParams{Strategy: RankBayesian, PriorWeight: 10, HalfLifeDays: 180, PositiveStars: 4}
+
+	if _, ok := RankStrategies[configs.Env("RANK_STRATEGY")]; ok {
+		params.Strategy = configs.Env("RANK_STRATEGY")
+	}
+	if weight, err := strconv.ParseFloat(configs.Env("RANK_PRIOR_WEIGHT"), 64); err == nil && weight >= 0 {
+		params.PriorWeight = weight
+	}
+	if days, err := strconv.ParseFloat(configs.Env("RANK_HALF_LIFE_DAYS"), 64); err == nil && days > 0 {
+		params.HalfLifeDays = days
+	}
+	if stars, err := strconv.Atoi(configs.Env("RANK_POSITIVE_STARS")); err == nil && stars >= 1 && stars <= 5 {
+		params.PositiveStars = stars
+	}
+	return params
+}
+
+func ratingRecomputeMinutes() int64 {
+	if minutes, err := strconv.ParseInt(configs.Env("RATING_RECOMPUTE_MINUTES"), 10, 64); err == nil && minutes > 0 {
+		return minutes
+	}
+	return 60
+}
+
+// RatingBucket is the star, "1" to "5", a rate is counted under in the distribution
+func RatingBucket(rate float64) string {
+	star := math.Round(rate)
+	if star < 1 {
+		star = 1
+	}
+	if star > 5 {
+		star = 5
+	}
+	return strconv.Itoa(int(star))
+}
+
+// Rank pulls the average of a doctor towards the prior mean, the fewer reviews the stronger,
+// so that a single five star review does not outrank a long record of good ones
+func Rank(sum float64, count float64, priorMean float64, priorWeight float64) float64 {
+	if count+priorWeight <= 0 {
+		return 0
+	}
+	return (sum + priorMean*priorWeight) / (count + priorWeight)
+}
+
+func BayesianRank(rating models.DoctorRating, params RankParams, now int64) float64 {
+	return Rank(rating.Sum, float64(rating.Count), params.PriorMean, params.PriorWeight)
+}
+
+// WilsonRank is the lower bound of the 95% Wilson score interval for the share of positive
+// reviews, between 0 and 1
+func WilsonRank(rating models.DoctorRating, params RankParams, now int64) float64 {
+	if rating.Count == 0 {
+		return 0
+	}
+
+	var positive int64
+	for star := params.PositiveStars; star <= 5; star++ {
+		positive += rating.Distribution[strconv.Itoa(star)]
+	}
+
+	const z = 1.96
+	n := float64(rating.Count)
+	p := float64(positive) / n
+	return (p + z*z/(2*n) - z*math.Sqrt((p*(1-p)+z*z/(4*n))/n)) / (1 + z*z/n)
+}
+
+// RecencyRank is the bayesian average over reviews weighted by their age, a review loses half
+// its weight every HalfLifeDays
+func RecencyRank(rating models.DoctorRating, params RankParams, now int64) float64 {
+	decay := Decay(rating.DecayedAt, now, params.HalfLifeDays)
+	return Rank(rating.DecayedSum*decay, rating.DecayedCount*decay, params.PriorMean, params.PriorWeight)
+}
+
+// Decay is the factor a weight given at the time since shrinks to by now
+func Decay(since int64, now int64, halfLifeDays float64) float64 {
+	if since <= 0 || now <= since {
+		return 1
+	}
+	return math.Pow(0.5, float64(now-since)/(halfLifeDays*24*60*60))
+}
+
+// Ranks scores the rating with every strategy
+func Ranks(rating models.DoctorRating, params RankParams, now int64) map[string]float64 {
+	ranks := make(map[string]float64, len(RankStrategies))
+	for name, strategy := range RankStrategies {
+		ranks[name] = strategy(rating, params, now)
+	}
+	return ranks
+}
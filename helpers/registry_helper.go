@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"doctorrank_go/models"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// MinRegistryConfidence is the lowest score for which a registry entry is reported as a match
+const MinRegistryConfidence = 0.3
+
+const MaxRegistryMatches = 5
+
+// RegistryCandidate is what is known about a doctor or an applicant when looking them up in the registry
+type RegistryCandidate struct {
+	FirstName     string
+	LastName      string
+	LicenseNumber string
+	Country       string
+	Profession    string
+}
+
+var registryColumns = map[string]string{
+	"license_number": "license_number",
+	"license":        "license_number",
+	"first_name":     "first_name",
+	"last_name":      "last_name",
+	"profession":     "profession",
+	"country":        "country",
+}
+
+// ParseRegistry reads registry entries from a CSV file with a header row or from a JSON array
+func ParseRegistry(reader io.Reader, format string) ([]models.RegistryEntry, error) {
+	var rows []map[string]string
+
+	switch strings.ToLower(format) {
+	case "csv":
+		records, err := csv.NewReader(reader).ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) < 1 {
+			return nil, errors.New("the registry file is empty")
+		}
+		header := records[0]
+		for _, record := range records[1:] {
+			row := map[string]string{}
+			for i, column := range header {
+				if i < len(record) {
+					row[strings.ToLower(strings.TrimSpace(column))] = record[i]
+				}
+			}
+			rows = append(rows, row)
+		}
+	case "json":
+		var objects []map[string]interface{}
+		if err := json.NewDecoder(reader).Decode(&objects); err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			row := map[string]string{}
+			for key, value := range object {
+				if value != nil {
+					row[key] = fmt.Sprint(value)
+				}
+			}
+			rows = append(rows, row)
+		}
+	default:
+		return nil, errors.New("registry files must be csv or json")
+	}
+
+	entries := make([]models.RegistryEntry, 0, len(rows))
+	for i, row := range rows {
+		fields := map[string]string{}
+		for column, value := range row {
+			if name, ok := registryColumns[strings.ToLower(column)]; ok {
+				fields[name] = strings.TrimSpace(value)
+			}
+		}
+		if fields["license_number"] == "" || fields["last_name"] == "" {
+			return nil, errors.New("registry row " + strconv.Itoa(i+1) + " needs a license number and a last name")
+		}
+		entries = append(entries, models.RegistryEntry{
+			LicenseNumber: fields["license_number"],
+			LicenseKey:    NormalizeLicense(fields["license_number"]),
+			Country:       strings.ToUpper(fields["country"]),
+			FirstName:     fields["first_name"],
+			LastName:      fields["last_name"],
+			LastNameKey:   NormalizeName(fields["last_name"]),
+			Profession:    fields["profession"],
+		})
+	}
+	return entries, nil
+}
+
+// NormalizeLicense drops everything but letters and digits so "AZ-123 45" and "az12345" compare equal
+func NormalizeLicense(license string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToUpper(r)
+		}
+		return -1
+	}, license)
+}
+
+func NormalizeName(name string) string {
+	return strings.Join(strings.Fields(strings.ToLower(name)), " ")
+}
+
+// ScoreRegistryEntry rates how likely entry describes candidate. The license number carries
+// most of the weight, names and profession only back it up.
+func ScoreRegistryEntry(candidate RegistryCandidate, entry models.RegistryEntry) (float64, []string) {
+	var score float64
+	var matchedOn []string
+
+	if license := NormalizeLicense(candidate.LicenseNumber); license != "" && license == entry.LicenseKey {
+		score += 0.5
+		matchedOn = append(matchedOn, "license_number")
+		if candidate.Country != "" && strings.EqualFold(candidate.Country, entry.Country) {
+			score += 0.1
+			matchedOn = append(matchedOn, "country")
+		}
+	}
+
+	if NormalizeName(candidate.LastName) == entry.LastNameKey {
+		score += 0.15
+		matchedOn = append(matchedOn, "last_name")
+		if firstName := NormalizeName(candidate.FirstName); firstName != "" && firstName == NormalizeName(entry.FirstName) {
+			score += 0.15
+			matchedOn = append(matchedOn, "first_name")
+		}
+	}
+
+	if profession := NormalizeName(candidate.Profession); profession != "" && profession == NormalizeName(entry.Profession) {
+		score += 0.1
+		matchedOn = append(matchedOn, "profession")
+	}
+
+	return score, matchedOn
+}
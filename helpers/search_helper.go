@@ -0,0 +1,158 @@
+package helpers
+
+import (
+	"golang.org/x/text/unicode/norm"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+const MaxSearchTokens = 5
+
+// SearchKeysVersion is stored with the search keys and raised whenever SearchKeys changes, so
+// that keys derived the old way are rebuilt on startup
+const SearchKeysVersion = 2
+
+// MaxSearchSpellings caps how many spellings of a value SearchKeys stores keys for
+const MaxSearchSpellings = 8
+
+// SuggestLimits cap how many suggestions of each type are returned, MaxSuggestLimit caps the
+// limit a client asks for. SuggestCandidates bounds how many matches of a type are scored.
+var SuggestLimits = map[string]int64{SuggestDoctor: 5, SuggestHospital: 3, SuggestProfession: 3}
+
+const MaxSuggestLimit = 10
+const SuggestCandidates = 50
+
+const (
+	SuggestDoctor     = "doctor"
+	SuggestHospital   = "hospital"
+	SuggestProfession = "profession"
+)
+
+// searchFolding spells letters of the Azerbaijani, Turkish and Russian alphabets the way they
+// are usually typed on an ASCII keyboard. Other accents are stripped after decomposition.
+var searchFolding = map[rune]string{
+	'ə': "e", 'ı': "i", 'ß': "ss", 'ø': "o", 'æ': "ae", 'đ': "d", 'ł': "l",
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "x", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'ә': "e", 'ғ': "g", 'ҝ': "g", 'ҹ': "c", 'ө': "o", 'ү': "u", 'һ': "h",
+	'ј': "y", 'і': "i",
+}
+
+// searchAlternates are the other common spellings of letters that are transliterated more than
+// one way, "Гусейнов" is as often written "Huseynov" as "Guseynov". Queries are folded with
+// searchFolding only, the stored keys carry the alternates.
+var searchAlternates = map[rune][]string{
+	'г': {"h"}, 'х': {"kh"}, 'ş': {"sh"}, 'ç': {"ch"},
+}
+
+// NormalizeSearch folds value to lowercase ASCII words separated by single spaces, so that
+// "Hüseynov" and "HUSEYNOV" read the same and "Гусейнов" becomes "guseynov"
+func NormalizeSearch(value string) string {
+	var builder strings.Builder
+	space := true
+
+	for _, r := range strings.ToLower(strings.ReplaceAll(value, "İ", "i")) {
+		folded, ok := searchFolding[r]
+		if !ok {
+			folded = stripMarks(r)
+		}
+		for _, f := range folded {
+			if unicode.IsLetter(f) || unicode.IsDigit(f) {
+				builder.WriteRune(f)
+				space = false
+			} else if !space {
+				builder.WriteRune(' ')
+				space = true
+			}
+		}
+	}
+
+	return strings.TrimSpace(builder.String())
+}
+
+func stripMarks(r rune) string {
+	var builder strings.Builder
+	for _, d := range norm.NFD.String(string(r)) {
+		if !unicode.Is(unicode.Mn, d) {
+			builder.WriteRune(d)
+		}
+	}
+	return builder.String()
+}
+
+// SearchTokens are the distinct normalized words of value
+func SearchTokens(value string) []string {
+	var tokens []string
+	seen := map[string]bool{}
+	for _, token := range strings.Fields(NormalizeSearch(value)) {
+		if !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// searchSpellings are the ways value may be typed, NormalizeSearch's first. Every letter with
+// alternates multiplies them, past MaxSearchSpellings further alternates are left out.
+func searchSpellings(value string) []string {
+	spellings := []string{""}
+
+	for _, r := range strings.ToLower(strings.ReplaceAll(value, "İ", "i")) {
+		folded, ok := searchFolding[r]
+		if !ok {
+			folded = stripMarks(r)
+		}
+		count := len(spellings)
+		for _, alternate := range searchAlternates[r] {
+			for i := 0; i < count && len(spellings) < MaxSearchSpellings; i++ {
+				spellings = append(spellings, spellings[i]+alternate)
+			}
+		}
+		for i := 0; i < count; i++ {
+			spellings[i] += folded
+		}
+	}
+
+	for i, spelling := range spellings {
+		spellings[i] = NormalizeSearch(spelling)
+	}
+	return spellings
+}
+
+// SearchKeys are stored on searchable documents: every word of every spelling of the values
+// plus its words written together, so that "abdulkerim" still finds "Abdul Kerim" and
+// "huseynov" finds "Гусейнов"
+func SearchKeys(values ...string) []string {
+	var keys []string
+	seen := map[string]bool{}
+	add := func(key string) {
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+
+	for _, spelling := range searchSpellings(strings.Join(values, " ")) {
+		words := strings.Fields(spelling)
+		for _, word := range words {
+			add(word)
+		}
+		if len(words) > 1 {
+			add(strings.Join(words, ""))
+		}
+	}
+	return keys
+}
+
+// SearchPrefixes are the anchored, escaped patterns a query matches stored keys with
+func SearchPrefixes(tokens []string) []string {
+	patterns := make([]string, len(tokens))
+	for i, token := range tokens {
+		patterns[i] = "^" + regexp.QuoteMeta(token)
+	}
+	return patterns
+}
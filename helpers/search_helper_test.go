@@ -0,0 +1,64 @@
+//go:build integration
+
+// The helpers package reads the .env and connects to MongoDB on init through configs, so even
+// these tests need both:
+//
+//	go test -tags integration ./helpers -run Search
+package helpers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeSearch(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Hüseynov", "huseynov"},
+		{"HUSEYNOV", "huseynov"},
+		{"Гусейнов", "guseynov"},
+		{"Əliyev", "eliyev"},
+		{"İsmayılov", "ismayilov"},
+		{"Şahin Çelik", "sahin celik"},
+		{"  Abdul   Kerim ", "abdul kerim"},
+		{"O'Neil-Smith", "o neil smith"},
+		{"", ""},
+	}
+
+	for _, test := range tests {
+		if got := NormalizeSearch(test.value); got != test.want {
+			t.Errorf("NormalizeSearch(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
+
+func TestSearchKeys(t *testing.T) {
+	tests := []struct {
+		values []string
+		want   []string
+	}{
+		{[]string{"Hüseynov"}, []string{"huseynov"}},
+		{[]string{"HUSEYNOV"}, []string{"huseynov"}},
+		{[]string{"Гусейнов"}, []string{"guseynov", "huseynov"}},
+		{[]string{"Хасанов"}, []string{"xasanov", "khasanov"}},
+		{[]string{"Şahin"}, []string{"sahin", "shahin"}},
+		{[]string{"Abdul", "Kerim"}, []string{"abdul", "kerim", "abdulkerim"}},
+		{[]string{"Abdul Abdul"}, []string{"abdul", "abdulabdul"}},
+		{[]string{""}, nil},
+	}
+
+	for _, test := range tests {
+		if got := SearchKeys(test.values...); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("SearchKeys(%q) = %q, want %q", test.values, got, test.want)
+		}
+	}
+}
+
+func TestSearchKeysAreCapped(t *testing.T) {
+	// every г and х has an alternate, the spellings would double with each of them
+	if got := searchSpellings("Гхгхгх"); len(got) != MaxSearchSpellings {
+		t.Errorf("searchSpellings gave %d spellings, want %d", len(got), MaxSearchSpellings)
+	}
+}
@@ -0,0 +1,36 @@
+package helpers
+
+type ThrottlePolicy struct {
+	FreeAttempts     int
+	LockoutThreshold int
+	LockoutMinutes   int64
+	WindowMinutes    int64
+	MaxDelaySeconds  int64
+}
+
+var AccountThrottle = ThrottlePolicy{FreeAttempts: 3, LockoutThreshold: 10, LockoutMinutes: 15, WindowMinutes: 60, MaxDelaySeconds: 300}
+var IpThrottle = ThrottlePolicy{FreeAttempts: 10, LockoutThreshold: 100, LockoutMinutes: 15, WindowMinutes: 60, MaxDelaySeconds: 60}
+var PasswordResetThrottle = ThrottlePolicy{FreeAttempts: 2, LockoutThreshold: 10, LockoutMinutes: 60, WindowMinutes: 60, MaxDelaySeconds: 600}
+var MagicLinkThrottle = ThrottlePolicy{FreeAttempts: 2, LockoutThreshold: 10, LockoutMinutes: 60, WindowMinutes: 60, MaxDelaySeconds: 600}
+var ActivationResendThrottle = ThrottlePolicy{FreeAttempts: 1, LockoutThreshold: 5, LockoutMinutes: 60, WindowMinutes: 60, MaxDelaySeconds: 900}
+var ActivationStatusThrottle = ThrottlePolicy{FreeAttempts: 30, LockoutThreshold: 200, LockoutMinutes: 15, WindowMinutes: 60, MaxDelaySeconds: 60}
+
+// Delay is the number of seconds a caller has to wait after the given number of failures.
+// It doubles with every failure past the free attempts.
+func (p ThrottlePolicy) Delay(failures int) int64 {
+	if failures <= p.FreeAttempts {
+		return 0
+	}
+	delay := int64(1)
+	for i := p.FreeAttempts; i < failures && delay < p.MaxDelaySeconds; i++ {
+		delay *= 2
+	}
+	if delay > p.MaxDelaySeconds {
+		delay = p.MaxDelaySeconds
+	}
+	return delay
+}
+
+func (p ThrottlePolicy) ShouldLock(failures int) bool {
+	return p.LockoutThreshold > 0 && failures >= p.LockoutThreshold
+}
@@ -1,7 +1,11 @@
 package helpers
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"doctorrank_go/configs"
+	"doctorrank_go/models"
+	"encoding/hex"
 	"fmt"
 	jwt "github.com/dgrijalva/jwt-go"
 	"log"
@@ -9,82 +13,200 @@ import (
 	"time"
 )
 
+type TokenKind string
+
+const (
+	AccessToken        TokenKind = "access"
+	RefreshToken       TokenKind = "refresh"
+	ActivationToken    TokenKind = "activation"
+	PasswordResetToken TokenKind = "password_reset"
+	MfaToken           TokenKind = "mfa"
+	UnlockToken        TokenKind = "unlock"
+	EmailChangeToken   TokenKind = "email_change"
+	ExportToken        TokenKind = "export"
+	MagicLinkToken     TokenKind = "magic_link"
+)
+
 type SignedDetails struct {
-	Email     string
-	FirstName string
-	LastName  string
-	Id        string
+	Email      string
+	FirstName  string
+	LastName   string
+	Id         string
+	SessionId  string
+	Role       string
+	Mfa        bool
+	RememberMe bool
+	// ImpersonatorId is the admin acting as the user, SessionId is then the impersonation id
+	ImpersonatorId string `json:",omitempty"`
+	// ExportId is the one data export a download link opens
+	ExportId string    `json:",omitempty"`
+	Type     TokenKind `json:"typ"`
 	jwt.StandardClaims
 }
 
 var SecretKey = configs.Env("SECRET_KEY")
+var TokenIssuer = tokenIssuer()
 var TokenMinutes, _ = strconv.ParseInt(configs.Env("TOKEN_MINUTES"), 10, 64)
 var RefreshTokenMinutes, _ = strconv.ParseInt(configs.Env("REFRESH_TOKEN_MINUTES"), 10, 64)
 var ActivationLinkMinutes, _ = strconv.ParseInt(configs.Env("REFRESH_TOKEN_MINUTES"), 10, 64)
 
-func GenerateToken(email string, firstName string, lastName string, uid string) (signedToken string, err error) {
+const MfaTokenMinutes = 5
+const MagicLinkMinutes = 15
+const PasswordResetMinutes = 30
+const UnlockLinkMinutes = 60
+const EmailChangeMinutes = 60
+const ImpersonationMinutes = 15
+
+func tokenIssuer() string {
+	if issuer := configs.Env("TOKEN_ISSUER"); issuer != "" {
+		return issuer
+	}
+	return "doctorrank"
+}
+
+// TokenAudience is the aud claim carried by tokens of the given kind
+func TokenAudience(kind TokenKind) string {
+	return TokenIssuer + ":" + string(kind)
+}
+
+func GenerateToken(user models.User, sessionId string) (signedToken string, err error) {
 	claims := &SignedDetails{
-		Email:     email,
-		FirstName: firstName,
-		LastName:  lastName,
-		Id:        uid,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Minute * time.Duration(TokenMinutes)).Unix(),
-		},
+		Email:     user.Email,
+		FirstName: user.FirstName,
+		LastName:  user.LastName,
+		Id:        user.Id.Hex(),
+		SessionId: sessionId,
+		Role:      user.Role,
+		Mfa:       user.Mfa.Enabled,
 	}
 
-	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SecretKey))
+	return signToken(AccessToken, claims, TokenMinutes)
+}
 
-	if err != nil {
-		log.Panic(err)
-		return
+// GenerateImpersonationToken issues an access token for user on behalf of the admin. It is
+// bound to the impersonation instead of a session and can not be refreshed.
+func GenerateImpersonationToken(user models.User, impersonationId string, adminId string) (signedToken string, err error) {
+	claims := &SignedDetails{
+		Email:          user.Email,
+		FirstName:      user.FirstName,
+		LastName:       user.LastName,
+		Id:             user.Id.Hex(),
+		SessionId:      impersonationId,
+		Role:           user.Role,
+		Mfa:            user.Mfa.Enabled,
+		ImpersonatorId: adminId,
 	}
 
-	return token, err
+	return signToken(AccessToken, claims, ImpersonationMinutes)
 }
-func GenerateRefreshToken(id string) (signedRefreshToken string, err error) {
+
+func GenerateRefreshToken(id string, sessionId string) (signedRefreshToken string, err error) {
 	refreshClaims := &SignedDetails{
-		Id: id,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Minute * time.Duration(RefreshTokenMinutes)).Unix(),
-		},
+		Id:        id,
+		SessionId: sessionId,
 	}
 
-	refreshToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims).SignedString([]byte(SecretKey))
+	return signToken(RefreshToken, refreshClaims, RefreshTokenMinutes)
+}
 
-	if err != nil {
-		log.Panic(err)
-		return
+// GenerateMfaToken issues the short-lived token a client exchanges, together with a second
+// factor, for a full login once the password has been verified
+func GenerateMfaToken(id string, rememberMe bool) (signedMfaToken string, err error) {
+	mfaClaims := &SignedDetails{
+		Id:         id,
+		RememberMe: rememberMe,
+	}
+
+	return signToken(MfaToken, mfaClaims, MfaTokenMinutes)
+}
+
+func GenerateMagicLinkToken(id string, rememberMe bool) (signedMagicLinkToken string, err error) {
+	magicLinkClaims := &SignedDetails{
+		Id:         id,
+		RememberMe: rememberMe,
 	}
 
-	return refreshToken, err
+	return signToken(MagicLinkToken, magicLinkClaims, MagicLinkMinutes)
 }
 
-func GenerateEmailToken(email string) (signedActivationToken string, err error) {
+// GenerateActivationToken signs an activation link with the given token id, which is stored on
+// the user so that only the most recently sent link can activate the account
+func GenerateActivationToken(email string, tokenId string) (signedActivationToken string, err error) {
 	activationClaims := &SignedDetails{
 		Email: email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: time.Now().Local().Add(time.Minute * time.Duration(ActivationLinkMinutes)).Unix(),
-		},
+	}
+	activationClaims.StandardClaims.Id = tokenId
+
+	return signToken(ActivationToken, activationClaims, ActivationLinkMinutes)
+}
+
+func GeneratePasswordResetToken(email string) (signedPasswordResetToken string, err error) {
+	passwordResetClaims := &SignedDetails{
+		Email: email,
 	}
 
-	activationToken, err := jwt.NewWithClaims(jwt.SigningMethodHS256, activationClaims).SignedString([]byte(SecretKey))
+	return signToken(PasswordResetToken, passwordResetClaims, PasswordResetMinutes)
+}
+
+func GenerateUnlockToken(id string) (signedUnlockToken string, err error) {
+	unlockClaims := &SignedDetails{
+		Id: id,
+	}
+
+	return signToken(UnlockToken, unlockClaims, UnlockLinkMinutes)
+}
+
+// GenerateEmailChangeToken carries the new address, which only becomes the login email
+// once the link sent to it is opened
+func GenerateEmailChangeToken(id string, newEmail string) (signedEmailChangeToken string, err error) {
+	emailChangeClaims := &SignedDetails{
+		Id:    id,
+		Email: newEmail,
+	}
+
+	return signToken(EmailChangeToken, emailChangeClaims, EmailChangeMinutes)
+}
+
+func GenerateExportToken(id string, exportId string) (signedExportToken string, err error) {
+	exportClaims := &SignedDetails{
+		Id:       id,
+		ExportId: exportId,
+	}
+
+	return signToken(ExportToken, exportClaims, ExportLinkMinutes)
+}
+
+func signToken(kind TokenKind, claims *SignedDetails, minutes int64) (signedToken string, err error) {
+	now := time.Now().Local()
+	tokenId := claims.StandardClaims.Id
+	if tokenId == "" {
+		tokenId = RandomToken(16)
+	}
+	claims.Type = kind
+	claims.StandardClaims = jwt.StandardClaims{
+		Id:        tokenId,
+		Audience:  TokenAudience(kind),
+		Issuer:    TokenIssuer,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(time.Minute * time.Duration(minutes)).Unix(),
+	}
+
+	token, err := Keys.Sign(claims)
 
 	if err != nil {
 		log.Panic(err)
 		return
 	}
 
-	return activationToken, err
+	return token, err
 }
 
-func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
+// ValidateToken parses signedToken and only accepts it if it was issued as the given kind
+func ValidateToken(signedToken string, kind TokenKind) (claims *SignedDetails, msg string) {
 	token, err := jwt.ParseWithClaims(
 		signedToken,
 		&SignedDetails{},
-		func(token *jwt.Token) (interface{}, error) {
-			return []byte(SecretKey), nil
-		},
+		Keys.VerificationKey,
 	)
 
 	if err != nil {
@@ -103,5 +225,25 @@ func ValidateToken(signedToken string) (claims *SignedDetails, msg string) {
 		return
 	}
 
+	if claims.Type != kind || !claims.VerifyAudience(TokenAudience(kind), true) || !claims.VerifyIssuer(TokenIssuer, true) {
+		msg = fmt.Sprintf("the token is invalid")
+		return
+	}
+
 	return claims, msg
 }
+
+// RandomToken returns n cryptographically random bytes encoded as hex
+func RandomToken(n int) string {
+	buffer := make([]byte, n)
+	if _, err := rand.Read(buffer); err != nil {
+		log.Panic(err)
+	}
+	return hex.EncodeToString(buffer)
+}
+
+// HashToken returns the hex encoded SHA-256 digest of a token, used to store tokens at rest
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
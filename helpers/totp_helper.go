@@ -0,0 +1,94 @@
+package helpers
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const TotpPeriod = 30
+const TotpDigits = 6
+const TotpIssuer = "Doctorrank"
+const RecoveryCodeCount = 10
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+func GenerateTotpSecret() string {
+	buffer := make([]byte, 20)
+	if _, err := rand.Read(buffer); err != nil {
+		log.Panic(err)
+	}
+	return totpEncoding.EncodeToString(buffer)
+}
+
+// TotpCode computes the RFC 6238 code of secret for the given time step
+func TotpCode(secret string, step int64) (string, error) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return "", err
+	}
+
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", TotpDigits, value%uint32(math.Pow10(TotpDigits))), nil
+}
+
+// VerifyTotp checks code against the current time step and one step of clock drift on
+// either side. It returns the matched step so callers can reject replays.
+func VerifyTotp(secret string, code string, now time.Time) (int64, bool) {
+	code = strings.ReplaceAll(code, " ", "")
+	if len(code) != TotpDigits {
+		return 0, false
+	}
+	current := now.Unix() / TotpPeriod
+	for _, step := range []int64{current - 1, current, current + 1} {
+		expected, err := TotpCode(secret, step)
+		if err != nil {
+			return 0, false
+		}
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(code)) == 1 {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// TotpProvisioningUri builds the otpauth:// uri authenticator apps read from a QR code
+func TotpProvisioningUri(account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", TotpIssuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(TotpDigits))
+	query.Set("period", fmt.Sprint(TotpPeriod))
+	label := url.PathEscape(TotpIssuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + query.Encode()
+}
+
+func GenerateRecoveryCodes() []string {
+	codes := make([]string, RecoveryCodeCount)
+	for i := range codes {
+		code := RandomToken(5)
+		codes[i] = code[:5] + "-" + code[5:]
+	}
+	return codes
+}
+
+func NormalizeRecoveryCode(code string) string {
+	return strings.ToLower(strings.TrimSpace(code))
+}
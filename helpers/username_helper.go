@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"doctorrank_go/configs"
+	"regexp"
+	"strings"
+)
+
+const UsernameCooldownDays = 30
+const UsernameGraceDays = 90
+
+var UsernamePattern = regexp.MustCompile(`^[A-Za-z0-9_.]{3,30}$`)
+
+// reservedUsernames can not be registered or changed to, USERNAME_RESERVED adds a comma
+// separated list to them
+var reservedUsernames = loadReservedUsernames()
+
+func loadReservedUsernames() map[string]bool {
+	reserved := map[string]bool{}
+	names := []string{
+		"admin", "administrator", "root", "system", "support", "help", "moderator", "staff",
+		"doctorrank", "api", "www", "mail", "me", "self", "users", "user", "doctors", "doctor",
+		"hospitals", "professions", "comments", "login", "logout", "register", "settings",
+		"search", "deleted", "deleted user", "null", "undefined", "anonymous",
+	}
+	names = append(names, strings.Split(configs.Env("USERNAME_RESERVED"), ",")...)
+	for _, name := range names {
+		if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+			reserved[name] = true
+		}
+	}
+	return reserved
+}
+
+func IsReservedUsername(username string) bool {
+	return reservedUsernames[strings.ToLower(username)]
+}
+
+// CheckUsername returns why username can not be used regardless of who holds it, or an empty
+// string when it is acceptable
+func CheckUsername(username string) string {
+	if !UsernamePattern.MatchString(username) {
+		return "username must be 3 to 30 letters, digits, dots or underscores"
+	}
+	if IsReservedUsername(username) {
+		return "this username is reserved"
+	}
+	return ""
+}
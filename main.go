@@ -2,6 +2,7 @@ package main
 
 import (
 	"doctorrank_go/configs"
+	"doctorrank_go/controllers"
 	"doctorrank_go/middlewares"
 	"doctorrank_go/routes"
 	"github.com/gin-gonic/gin"
@@ -19,12 +20,16 @@ func main() {
 
 	router := gin.Default()
 	configs.ConnectDB()
+	configs.EnsureIndexes(configs.DB)
+	go controllers.ScheduleRatingRecompute()
+	go controllers.EnsureSearchKeys()
+	go controllers.ScheduleExportCleanup()
 
 	c := cors.New(cors.Options{
 		AllowedOrigins:   []string{configs.Env("CLIENT")},
 		AllowedMethods:   []string{http.MethodHead, http.MethodOptions, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete},
 		AllowCredentials: true,
-		AllowedHeaders:   []string{"Origin", "Authorization", "Content-Type"},
+		AllowedHeaders:   []string{"Origin", "Authorization", "Content-Type", "X-API-Key"},
 	})
 	router.Use(c)
 
@@ -33,6 +38,13 @@ func main() {
 	routes.CommentRoute(router)
 	routes.HospitalRoute(router)
 	routes.ProfessionRoute(router)
+	routes.SearchRoute(router)
+	routes.SessionRoute(router)
+	routes.TokenRoute(router)
+	routes.DoctorApplicationRoute(router)
+	routes.OauthRoute(router)
+	routes.PartnerRoute(router)
+	routes.AdminRoute(router)
 
 	router.Use(middlewares.Authentication())
 
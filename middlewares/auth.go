@@ -1,13 +1,35 @@
 package middlewares
 
 import (
+	"context"
+	"doctorrank_go/configs"
 	"doctorrank_go/helpers"
+	"doctorrank_go/models"
 	"doctorrank_go/responses"
 	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"log"
 	"net/http"
 	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
+var sessionCollection *mongo.Collection = configs.GetCollection(configs.DB, "sessions")
+var impersonationCollection *mongo.Collection = configs.GetCollection(configs.DB, "impersonations")
+var auditLogCollection *mongo.Collection = configs.GetCollection(configs.DB, "audit_logs")
+
+// sessionCheckSeconds is how long a session found active is trusted without asking the
+// database again, so a revocation reaches the access tokens of that session within this delay
+const sessionCheckSeconds = 30
+
+// activeSessions maps session ids to the unix time they were last found active
+var activeSessions sync.Map
+var activeSessionsSweptAt int64
+
 func Authentication() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		auth := c.Request.Header.Get("Authorization")
@@ -22,17 +44,133 @@ func Authentication() gin.HandlerFunc {
 			c.Abort()
 			return
 		}
-		claims, err := helpers.ValidateToken(token)
+		claims, err := helpers.ValidateToken(token, helpers.AccessToken)
 		if err != "" {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": err})
 			c.Abort()
 			return
 		}
+		if claims.ImpersonatorId != "" {
+			if !impersonationActive(claims.SessionId) {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "the impersonation has ended"})
+				c.Abort()
+				return
+			}
+		} else if !sessionActive(claims.SessionId) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "the session has been revoked"})
+			c.Abort()
+			return
+		}
 		c.Set("email", claims.Email)
 		c.Set("first_name", claims.FirstName)
 		c.Set("last_name", claims.LastName)
 		c.Set("_id", claims.Id)
+		c.Set("session_id", claims.SessionId)
+		c.Set("role", claims.Role)
+		c.Set("mfa", claims.Mfa)
+		c.Set("impersonator_id", claims.ImpersonatorId)
+
+		if claims.ImpersonatorId != "" {
+			impersonate(c, claims)
+			return
+		}
 
 		c.Next()
 	}
 }
+
+// impersonate lets an admin see what the user sees but nothing more: only reads go through
+// and every request, allowed or not, ends up in the audit log
+func impersonate(c *gin.Context, claims *helpers.SignedDetails) {
+	method := c.Request.Method
+	blocked := method != http.MethodGet && method != http.MethodHead && method != http.MethodOptions
+	if blocked {
+		c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "write operations are not allowed while impersonating"})
+		c.Abort()
+	} else {
+		c.Next()
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	adminId, _ := primitive.ObjectIDFromHex(claims.ImpersonatorId)
+	userId, _ := primitive.ObjectIDFromHex(claims.Id)
+	impersonationId, _ := primitive.ObjectIDFromHex(claims.SessionId)
+	auditLog := models.AuditLog{
+		Id:              primitive.NewObjectID(),
+		Action:          models.AuditImpersonationRequest,
+		ActorId:         adminId,
+		UserId:          userId,
+		ImpersonationId: impersonationId,
+		Method:          method,
+		Path:            c.Request.URL.Path,
+		Status:          c.Writer.Status(),
+		Blocked:         blocked,
+		Ip:              c.ClientIP(),
+		UserAgent:       c.Request.UserAgent(),
+		CreatedAt:       time.Now().Unix(),
+	}
+	if _, err := auditLogCollection.InsertOne(ctx, auditLog); err != nil {
+		log.Println(err)
+	}
+}
+
+func impersonationActive(impersonationId string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(impersonationId)
+	if err != nil {
+		return false
+	}
+	count, err := impersonationCollection.CountDocuments(ctx, bson.M{"_id": id, "ended_at": 0, "expires_at": bson.M{"$gt": time.Now().Unix()}})
+	return err == nil && count > 0
+}
+
+// sessionActive makes access tokens die together with their session, e.g. after a password,
+// email or role change, instead of staying usable until they expire.
+//
+// This costs a lookup per session every sessionCheckSeconds rather than none at all, which is
+// the price of revocation taking effect in seconds instead of after the access token lifetime.
+// A session that cannot be looked up is treated as revoked.
+func sessionActive(sessionId string) bool {
+	now := time.Now().Unix()
+	if checkedAt, ok := activeSessions.Load(sessionId); ok && now-checkedAt.(int64) < sessionCheckSeconds {
+		return true
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(sessionId)
+	if err != nil {
+		return false
+	}
+	count, err := sessionCollection.CountDocuments(ctx, bson.M{"_id": id, "revoked_at": 0, "expires_at": bson.M{"$gt": now}})
+	if err != nil {
+		log.Println(err)
+		return false
+	}
+	if count == 0 {
+		activeSessions.Delete(sessionId)
+		return false
+	}
+	activeSessions.Store(sessionId, now)
+	sweepActiveSessions(now)
+	return true
+}
+
+// sweepActiveSessions forgets sessions that have not been seen for a while
+func sweepActiveSessions(now int64) {
+	sweptAt := atomic.LoadInt64(&activeSessionsSweptAt)
+	if now-sweptAt < sessionCheckSeconds || !atomic.CompareAndSwapInt64(&activeSessionsSweptAt, sweptAt, now) {
+		return
+	}
+	activeSessions.Range(func(sessionId, checkedAt interface{}) bool {
+		if now-checkedAt.(int64) >= sessionCheckSeconds {
+			activeSessions.Delete(sessionId)
+		}
+		return true
+	})
+}
@@ -1,33 +1,29 @@
 package middlewares
 
 import (
-	"context"
 	"doctorrank_go/configs"
+	"doctorrank_go/helpers"
 	"doctorrank_go/responses"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 	"net/http"
-	"time"
 )
 
-var userCollection *mongo.Collection = configs.GetCollection(configs.DB, "users")
-
-func RoleDoctor() gin.HandlerFunc {
+// RequirePermission only lets the request through when the role carried by the access token
+// grants every one of the permissions
+func RequirePermission(permissions ...helpers.Permission) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-		defer cancel()
-		id := c.GetString("_id")
-		objId, _ := primitive.ObjectIDFromHex(id)
-		count, err := userCollection.CountDocuments(ctx, bson.M{"$and": bson.A{bson.M{"_id": objId}, bson.M{"role": "doctor"}}})
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, responses.Response{Status: http.StatusInternalServerError, Message: "error", Data: err.Error()})
-			return
-		}
-		if count < 1 {
-			c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "only doctors can do this action"})
-			return
+		role := c.GetString("role")
+		for _, permission := range permissions {
+			if !helpers.HasPermission(role, permission) {
+				c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "you do not have permission to do this action"})
+				c.Abort()
+				return
+			}
+			if role == helpers.RoleDoctor && configs.MFA_REQUIRED_FOR_DOCTORS && !c.GetBool("mfa") && !helpers.HasPermission(helpers.RoleUser, permission) {
+				c.JSON(http.StatusForbidden, responses.Response{Status: http.StatusForbidden, Message: "error", Data: "doctor accounts must enable two-factor authentication"})
+				c.Abort()
+				return
+			}
 		}
 
 		c.Next()
@@ -0,0 +1,25 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type ApiKey struct {
+	Id         primitive.ObjectID `bson:"_id" json:"_id"`
+	Name       string             `bson:"name" json:"name"`
+	Prefix     string             `bson:"prefix" json:"prefix"`
+	KeyHash    string             `bson:"key_hash" json:"-"`
+	Scopes     []string           `bson:"scopes" json:"scopes"`
+	CreatedBy  primitive.ObjectID `bson:"created_by" json:"created_by"`
+	UsageCount int64              `bson:"usage_count" json:"usage_count"`
+	LastUsedAt int64              `bson:"last_used_at" json:"last_used_at"`
+	ExpiresAt  int64              `bson:"expires_at" json:"expires_at"`
+	RevokedAt  int64              `bson:"revoked_at" json:"revoked_at"`
+	CreatedAt  int64              `bson:"created_at" json:"created_at"`
+}
+
+// ApiKeyUsage counts the requests made with a key on one UTC day
+type ApiKeyUsage struct {
+	Id    string             `bson:"_id" json:"-"`
+	KeyId primitive.ObjectID `bson:"key_id" json:"key_id"`
+	Day   string             `bson:"day" json:"day"`
+	Count int64              `bson:"count" json:"count"`
+}
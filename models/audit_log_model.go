@@ -0,0 +1,25 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+const (
+	AuditImpersonationStarted = "impersonation.started"
+	AuditImpersonationRequest = "impersonation.request"
+	AuditImpersonationEnded   = "impersonation.ended"
+)
+
+type AuditLog struct {
+	Id              primitive.ObjectID `bson:"_id" json:"_id"`
+	Action          string             `bson:"action" json:"action"`
+	ActorId         primitive.ObjectID `bson:"actor_id" json:"actor_id"`
+	UserId          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	ImpersonationId primitive.ObjectID `bson:"impersonation_id,omitempty" json:"impersonation_id,omitempty"`
+	Method          string             `bson:"method,omitempty" json:"method,omitempty"`
+	Path            string             `bson:"path,omitempty" json:"path,omitempty"`
+	Status          int                `bson:"status,omitempty" json:"status,omitempty"`
+	Blocked         bool               `bson:"blocked" json:"blocked"`
+	Detail          string             `bson:"detail,omitempty" json:"detail,omitempty"`
+	Ip              string             `bson:"ip" json:"ip"`
+	UserAgent       string             `bson:"user_agent" json:"user_agent"`
+	CreatedAt       int64              `bson:"created_at" json:"created_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ConsumedToken is kept until the token would have expired anyway. ExpiresAt is a date rather
+// than a unix timestamp so that the TTL index on it can purge the record.
+type ConsumedToken struct {
+	Id         string    `bson:"_id" json:"_id"`
+	Type       string    `bson:"type" json:"type"`
+	Subject    string    `bson:"subject" json:"subject"`
+	ConsumedAt int64     `bson:"consumed_at" json:"consumed_at"`
+	ExpiresAt  time.Time `bson:"expires_at" json:"expires_at"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type DataExport struct {
+	Id          primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Status      string             `bson:"status" json:"status"`
+	File        string             `bson:"file" json:"-"`
+	Error       string             `bson:"error" json:"error,omitempty"`
+	CreatedAt   int64              `bson:"created_at" json:"created_at"`
+	CompletedAt int64              `bson:"completed_at" json:"completed_at"`
+	ExpiresAt   int64              `bson:"expires_at" json:"expires_at"`
+}
+
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+	ExportExpired = "expired"
+)
@@ -0,0 +1,25 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type DoctorApplication struct {
+	Id              primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	DoctorId        primitive.ObjectID `bson:"doctor_id" json:"doctor_id"`
+	LicenseNumber   string             `bson:"license_number" json:"license_number"`
+	IssuingCountry  string             `bson:"issuing_country" json:"issuing_country"`
+	Documents       []string           `bson:"documents" json:"documents"`
+	RegistryMatches []RegistryMatch    `bson:"registry_matches,omitempty" json:"-"`
+	Status          string             `bson:"status" json:"status"`
+	Reason          string             `bson:"reason" json:"reason"`
+	ReviewedBy      primitive.ObjectID `bson:"reviewed_by" json:"reviewed_by"`
+	ReviewedAt      int64              `bson:"reviewed_at" json:"reviewed_at"`
+	CreatedAt       int64              `bson:"created_at" json:"created_at"`
+	UpdatedAt       int64              `bson:"updated_at" json:"updated_at"`
+}
+
+const (
+	ApplicationPending  = "pending"
+	ApplicationApproved = "approved"
+	ApplicationRejected = "rejected"
+)
@@ -3,20 +3,49 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Doctor struct {
-	Id           primitive.ObjectID `bson:"_id" json:"_id"`
-	UserId       primitive.ObjectID `bson:"user_id" json:"user_id"`
-	Title        string             `bson:"title" json:"title" validate:"required"`
-	FirstName    string             `bson:"first_name" json:"first_name" validate:"required"`
-	LastName     string             `bson:"last_name" json:"last_name" validate:"required"`
-	Img          string             `bson:"img" json:"img"`
-	About        string             `bson:"about" json:"about"`
-	ProfessionId primitive.ObjectID `bson:"profession_id" json:"profession_id"`
-	HospitalId   primitive.ObjectID `bson:"hospital_id" json:"hospital_id"`
-	Experience   []Experience       `bson:"experience" json:"experience"`
-	Education    []Education        `bson:"education" json:"education"`
-	Contact      Contact            `bson:"contact" json:"contact"`
-	CreatedAt    int64              `bson:"created_at" json:"created_at"`
-	UpdatedAt    int64              `bson:"updated_at" json:"updated_at"`
+	Id              primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Title           string             `bson:"title" json:"title" validate:"required"`
+	FirstName       string             `bson:"first_name" json:"first_name" validate:"required"`
+	LastName        string             `bson:"last_name" json:"last_name" validate:"required"`
+	Img             string             `bson:"img" json:"img"`
+	About           string             `bson:"about" json:"about"`
+	ProfessionId    primitive.ObjectID `bson:"profession_id" json:"profession_id"`
+	HospitalId      primitive.ObjectID `bson:"hospital_id" json:"hospital_id"`
+	Experience      []Experience       `bson:"experience" json:"experience"`
+	Education       []Education        `bson:"education" json:"education"`
+	Contact         Contact            `bson:"contact" json:"contact"`
+	License         License            `bson:"license" json:"-"`
+	RegistryMatches []RegistryMatch    `bson:"registry_matches,omitempty" json:"-"`
+	Rating          DoctorRating       `bson:"rating" json:"rating"`
+	Rank            float64            `bson:"rank" json:"rank"`
+	Ranks           map[string]float64 `bson:"ranks,omitempty" json:"ranks"`
+	SearchKeys      []string           `bson:"search_keys,omitempty" json:"-"`
+	SearchName      string             `bson:"search_name,omitempty" json:"-"`
+	SearchVersion   int                `bson:"search_version,omitempty" json:"-"`
+	CreatedAt       int64              `bson:"created_at" json:"created_at"`
+	UpdatedAt       int64              `bson:"updated_at" json:"updated_at"`
+}
+
+// DoctorRating is kept up to date on every comment write and rebuilt periodically
+type DoctorRating struct {
+	Value        float64          `bson:"value" json:"value"`
+	Count        int64            `bson:"count" json:"count"`
+	Sum          float64          `bson:"sum" json:"-"`
+	Distribution map[string]int64 `bson:"distribution,omitempty" json:"distribution"`
+	DecayedSum   float64          `bson:"decayed_sum" json:"-"`
+	DecayedCount float64          `bson:"decayed_count" json:"-"`
+	DecayedAt    int64            `bson:"decayed_at" json:"-"`
+	UpdatedAt    int64            `bson:"updated_at" json:"updated_at"`
+}
+
+// RatingPrior is the global average every doctor's rank is pulled towards
+type RatingPrior struct {
+	Id         string  `bson:"_id" json:"-"`
+	Mean       float64 `bson:"mean" json:"mean"`
+	Doctors    int64   `bson:"doctors" json:"doctors"`
+	Comments   int64   `bson:"comments" json:"comments"`
+	ComputedAt int64   `bson:"computed_at" json:"computed_at"`
 }
 
 type Experience struct {
@@ -38,6 +67,14 @@ type Education struct {
 	TermEnd     int64              `bson:"term_end" json:"term_end"`
 	Country     string             `bson:"country" json:"country"`
 }
+
+type License struct {
+	Number        string             `bson:"number" json:"number"`
+	Country       string             `bson:"country" json:"country"`
+	ApplicationId primitive.ObjectID `bson:"application_id" json:"application_id"`
+	VerifiedAt    int64              `bson:"verified_at" json:"verified_at"`
+}
+
 type Contact struct {
 	Phone    string `bson:"phone" json:"phone"`
 	Email    string `bson:"email" json:"email"`
@@ -3,7 +3,10 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Hospital struct {
-	Id   primitive.ObjectID `bson:"_id" json:"_id"`
-	Name string             `bson:"name" json:"name"`
-	Img  string             `bson:"img" json:"img"`
+	Id            primitive.ObjectID `bson:"_id" json:"_id"`
+	Name          string             `bson:"name" json:"name"`
+	Img           string             `bson:"img" json:"img"`
+	SearchKeys    []string           `bson:"search_keys,omitempty" json:"-"`
+	SearchName    string             `bson:"search_name,omitempty" json:"-"`
+	SearchVersion int                `bson:"search_version,omitempty" json:"-"`
 }
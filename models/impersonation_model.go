@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Impersonation struct {
+	Id        primitive.ObjectID `bson:"_id" json:"_id"`
+	AdminId   primitive.ObjectID `bson:"admin_id" json:"admin_id"`
+	UserId    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Reason    string             `bson:"reason" json:"reason"`
+	CreatedAt int64              `bson:"created_at" json:"created_at"`
+	ExpiresAt int64              `bson:"expires_at" json:"expires_at"`
+	EndedAt   int64              `bson:"ended_at" json:"ended_at"`
+}
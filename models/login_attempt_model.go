@@ -0,0 +1,13 @@
+package models
+
+type LoginAttempt struct {
+	Id            string `bson:"_id" json:"_id"`
+	Scope         string `bson:"scope" json:"scope"`
+	Subject       string `bson:"subject" json:"subject"`
+	Failures      int    `bson:"failures" json:"failures"`
+	LastFailureAt int64  `bson:"last_failure_at" json:"last_failure_at"`
+	NextAttemptAt int64  `bson:"next_attempt_at" json:"next_attempt_at"`
+	LockedUntil   int64  `bson:"locked_until" json:"locked_until"`
+	Lockouts      int    `bson:"lockouts" json:"lockouts"`
+	UpdatedAt     int64  `bson:"updated_at" json:"updated_at"`
+}
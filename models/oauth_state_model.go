@@ -0,0 +1,13 @@
+package models
+
+// OauthState remembers an authorization request between the redirect to the provider and
+// the callback. The state value sent to the provider is the id.
+type OauthState struct {
+	Id         string `bson:"_id" json:"-"`
+	Provider   string `bson:"provider" json:"provider"`
+	Verifier   string `bson:"verifier" json:"-"`
+	Nonce      string `bson:"nonce" json:"-"`
+	RememberMe bool   `bson:"remember_me" json:"remember_me"`
+	CreatedAt  int64  `bson:"created_at" json:"created_at"`
+	ExpiresAt  int64  `bson:"expires_at" json:"expires_at"`
+}
@@ -3,6 +3,9 @@ package models
 import "go.mongodb.org/mongo-driver/bson/primitive"
 
 type Profession struct {
-	Id   primitive.ObjectID `bson:"_id" json:"_id"`
-	Name string             `bson:"name" json:"name" validate:"required"`
+	Id            primitive.ObjectID `bson:"_id" json:"_id"`
+	Name          string             `bson:"name" json:"name" validate:"required"`
+	SearchKeys    []string           `bson:"search_keys,omitempty" json:"-"`
+	SearchName    string             `bson:"search_name,omitempty" json:"-"`
+	SearchVersion int                `bson:"search_version,omitempty" json:"-"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type RegistryEntry struct {
+	Id            primitive.ObjectID `bson:"_id" json:"_id"`
+	LicenseNumber string             `bson:"license_number" json:"license_number"`
+	LicenseKey    string             `bson:"license_key" json:"-"`
+	Country       string             `bson:"country" json:"country"`
+	FirstName     string             `bson:"first_name" json:"first_name"`
+	LastName      string             `bson:"last_name" json:"last_name"`
+	LastNameKey   string             `bson:"last_name_key" json:"-"`
+	Profession    string             `bson:"profession" json:"profession"`
+	Source        string             `bson:"source" json:"source"`
+	ImportedAt    int64              `bson:"imported_at" json:"imported_at"`
+}
+
+type RegistryMatch struct {
+	EntryId       primitive.ObjectID `bson:"entry_id" json:"entry_id"`
+	LicenseNumber string             `bson:"license_number" json:"license_number"`
+	Country       string             `bson:"country" json:"country"`
+	Name          string             `bson:"name" json:"name"`
+	Profession    string             `bson:"profession" json:"profession"`
+	Confidence    float64            `bson:"confidence" json:"confidence"`
+	MatchedOn     []string           `bson:"matched_on" json:"matched_on"`
+}
@@ -0,0 +1,18 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+type Session struct {
+	Id              primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId          primitive.ObjectID `bson:"user_id" json:"user_id"`
+	TokenHash       string             `bson:"token_hash" json:"-"`
+	RotatedHashes   []string           `bson:"rotated_hashes" json:"-"`
+	RememberMe      bool               `bson:"remember_me" json:"remember_me"`
+	UserAgent       string             `bson:"user_agent" json:"user_agent"`
+	Ip              string             `bson:"ip" json:"ip"`
+	CreatedAt       int64              `bson:"created_at" json:"created_at"`
+	LastRefreshedAt int64              `bson:"last_refreshed_at" json:"last_refreshed_at"`
+	ExpiresAt       int64              `bson:"expires_at" json:"expires_at"`
+	RevokedAt       int64              `bson:"revoked_at" json:"revoked_at"`
+	RevokedReason   string             `bson:"revoked_reason" json:"revoked_reason"`
+}
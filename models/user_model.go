@@ -5,18 +5,24 @@ import (
 )
 
 type User struct {
-	Id             primitive.ObjectID `bson:"_id" json:"_id"`
-	FirstName      string             `bson:"first_name" json:"first_name" validate:"required"`
-	LastName       string             `bson:"last_name" json:"last_name" validate:"required"`
-	Email          string             `bson:"email" json:"email" validate:"email,required"`
-	Username       string             `bson:"username" json:"username" validate:"required"`
-	Password       string             `bson:"password" json:"password" validate:"required,min=6"`
-	Role           string             `bson:"role" json:"role"`
-	Img            string             `bson:"img" json:"img"`
-	EmailConfirmed bool               `bson:"email_confirmed" json:"email_confirmed"`
-	Contact        UserContact        `bson:"contact" json:"contact"`
-	CreatedAt      int64              `bson:"created_at" json:"created_at"`
-	UpdatedAt      int64              `bson:"updated_at" json:"updated_at"`
+	Id                primitive.ObjectID `bson:"_id" json:"_id"`
+	FirstName         string             `bson:"first_name" json:"first_name" validate:"required"`
+	LastName          string             `bson:"last_name" json:"last_name" validate:"required"`
+	Email             string             `bson:"email" json:"email" validate:"email,required"`
+	Username          string             `bson:"username" json:"username" validate:"required"`
+	Password          string             `bson:"password" json:"password" validate:"required,min=6"`
+	Role              string             `bson:"role" json:"role"`
+	Img               string             `bson:"img" json:"img"`
+	EmailConfirmed    bool               `bson:"email_confirmed" json:"email_confirmed"`
+	PendingEmail      string             `bson:"pending_email" json:"pending_email"`
+	ActivationTokenId string             `bson:"activation_token_id,omitempty" json:"-"`
+	Contact           UserContact        `bson:"contact" json:"contact"`
+	Privacy           UserPrivacy        `bson:"privacy" json:"privacy"`
+	Mfa               UserMfa            `bson:"mfa" json:"-"`
+	PasswordHistory   []string           `bson:"password_history,omitempty" json:"-"`
+	LinkedIdentities  []LinkedIdentity   `bson:"linked_identities,omitempty" json:"linked_identities"`
+	CreatedAt         int64              `bson:"created_at" json:"created_at"`
+	UpdatedAt         int64              `bson:"updated_at" json:"updated_at"`
 }
 
 type UserContact struct {
@@ -24,3 +30,27 @@ type UserContact struct {
 	Email    string `bson:"email" json:"email"`
 	Facebook string `bson:"facebook" json:"facebook"`
 }
+
+// UserPrivacy controls the public profile. With a pseudonym the reviews are shown under it and
+// are no longer listed on the profile, so they can not be traced back to the username.
+type UserPrivacy struct {
+	HideProfile  bool   `bson:"hide_profile" json:"hide_profile"`
+	UsePseudonym bool   `bson:"use_pseudonym" json:"use_pseudonym"`
+	Pseudonym    string `bson:"pseudonym" json:"pseudonym"`
+}
+
+type UserMfa struct {
+	Enabled       bool     `bson:"enabled" json:"enabled"`
+	Secret        string   `bson:"secret" json:"-"`
+	PendingSecret string   `bson:"pending_secret" json:"-"`
+	RecoveryCodes []string `bson:"recovery_codes" json:"-"`
+	LastUsedStep  int64    `bson:"last_used_step" json:"-"`
+	EnabledAt     int64    `bson:"enabled_at" json:"enabled_at"`
+}
+
+type LinkedIdentity struct {
+	Provider string `bson:"provider" json:"provider"`
+	Subject  string `bson:"subject" json:"-"`
+	Email    string `bson:"email" json:"email"`
+	LinkedAt int64  `bson:"linked_at" json:"linked_at"`
+}
@@ -0,0 +1,13 @@
+package models
+
+import "go.mongodb.org/mongo-driver/bson/primitive"
+
+// UsernameHistory keeps a replaced username, which resolves to the account and can not be
+// taken by anyone else until ReleasedAt
+type UsernameHistory struct {
+	Id         primitive.ObjectID `bson:"_id" json:"_id"`
+	UserId     primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Username   string             `bson:"username" json:"username"`
+	ChangedAt  int64              `bson:"changed_at" json:"changed_at"`
+	ReleasedAt int64              `bson:"released_at" json:"released_at"`
+}
@@ -0,0 +1,49 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"doctorrank_go/helpers"
+	"doctorrank_go/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func AdminRoute(router *gin.Engine) {
+	admin := router.Group("/admin", middlewares.Authentication())
+
+	admin.GET("/users", middlewares.RequirePermission(helpers.PermissionManageUsers), controllers.AllUsers())
+	admin.GET("/users/:userId", middlewares.RequirePermission(helpers.PermissionManageUsers), controllers.UserById())
+	admin.PUT("/users/:userId/role", middlewares.RequirePermission(helpers.PermissionManageUsers), controllers.UpdateUserRole())
+	admin.POST("/users/:userId/impersonate", middlewares.RequirePermission(helpers.PermissionImpersonateUsers), controllers.StartImpersonation())
+
+	admin.DELETE("/impersonations/:impersonationId", middlewares.RequirePermission(helpers.PermissionImpersonateUsers), controllers.EndImpersonation())
+	admin.GET("/audit-logs", middlewares.RequirePermission(helpers.PermissionImpersonateUsers), controllers.AllAuditLogs())
+
+	admin.PUT("/doctors/:doctorId", middlewares.RequirePermission(helpers.PermissionManageDoctors), controllers.AdminUpdateDoctor())
+	admin.DELETE("/doctors/:doctorId", middlewares.RequirePermission(helpers.PermissionManageDoctors), controllers.DeleteDoctor())
+	admin.POST("/ratings/recompute", middlewares.RequirePermission(helpers.PermissionManageDoctors), controllers.RecomputeRatingsNow())
+	admin.GET("/ratings/preview", middlewares.RequirePermission(helpers.PermissionManageDoctors), controllers.RankingPreview())
+
+	admin.PUT("/hospitals/:hospitalId", middlewares.RequirePermission(helpers.PermissionManageHospitals), controllers.UpdateHospital())
+	admin.DELETE("/hospitals/:hospitalId", middlewares.RequirePermission(helpers.PermissionManageHospitals), controllers.DeleteHospital())
+
+	admin.PUT("/professions/:professionId", middlewares.RequirePermission(helpers.PermissionManageProfessions), controllers.UpdateProfession())
+	admin.DELETE("/professions/:professionId", middlewares.RequirePermission(helpers.PermissionManageProfessions), controllers.DeleteProfession())
+
+	admin.DELETE("/comments/:comment_id", middlewares.RequirePermission(helpers.PermissionModerateComments), controllers.DeleteComment())
+
+	admin.GET("/doctor-applications", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.AllDoctorApplications())
+	admin.GET("/doctor-applications/:applicationId/documents/:fileName", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.DoctorApplicationDocument())
+	admin.POST("/doctor-applications/:applicationId/approve", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.ApproveDoctorApplication())
+	admin.POST("/doctor-applications/:applicationId/reject", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.RejectDoctorApplication())
+
+	admin.POST("/registry/import", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.ImportRegistry())
+	admin.GET("/registry/doctor-matches", middlewares.RequirePermission(helpers.PermissionReviewApplications), controllers.RegistryDoctorMatches())
+
+	admin.POST("/api-keys", middlewares.RequirePermission(helpers.PermissionManageApiKeys), controllers.CreateApiKey())
+	admin.GET("/api-keys", middlewares.RequirePermission(helpers.PermissionManageApiKeys), controllers.AllApiKeys())
+	admin.DELETE("/api-keys/:keyId", middlewares.RequirePermission(helpers.PermissionManageApiKeys), controllers.RevokeApiKey())
+	admin.GET("/api-keys/:keyId/usage", middlewares.RequirePermission(helpers.PermissionManageApiKeys), controllers.ApiKeyUsage())
+
+	admin.GET("/lockouts", middlewares.RequirePermission(helpers.PermissionManageLockouts), controllers.AllLockouts())
+	admin.DELETE("/lockouts/:key", middlewares.RequirePermission(helpers.PermissionManageLockouts), controllers.ClearLockout())
+}
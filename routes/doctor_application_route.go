@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"doctorrank_go/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func DoctorApplicationRoute(router *gin.Engine) {
+	router.POST("/doctor-applications", middlewares.Authentication(), controllers.CreateDoctorApplication())
+	router.GET("/doctor-applications/self", middlewares.Authentication(), controllers.DoctorApplicationsBySelf())
+}
@@ -0,0 +1,12 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+func OauthRoute(router *gin.Engine) {
+	router.GET("/oauth/providers", controllers.OauthProviders())
+	router.GET("/oauth/:provider/authorize", controllers.OauthAuthorize())
+	router.POST("/oauth/:provider/callback", controllers.OauthCallback())
+}
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"doctorrank_go/helpers"
+	"doctorrank_go/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+// PartnerRoute exposes read-only data to clinics and insurers authenticated by api key
+func PartnerRoute(router *gin.Engine) {
+	partner := router.Group("/partner")
+
+	partner.GET("/doctors", middlewares.ApiKey(helpers.ScopeDoctorsRead), controllers.AllDoctors())
+	partner.GET("/doctors/:doctorId", middlewares.ApiKey(helpers.ScopeDoctorsRead), controllers.DoctorById())
+	partner.GET("/comments", middlewares.ApiKey(helpers.ScopeCommentsRead), controllers.AllComments())
+	partner.GET("/hospitals", middlewares.ApiKey(helpers.ScopeHospitalsRead), controllers.AllHospitals())
+	partner.GET("/professions", middlewares.ApiKey(helpers.ScopeProfessionsRead), controllers.AllProfessions())
+}
@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+func SearchRoute(router *gin.Engine) {
+	router.GET("/search/suggest", controllers.SearchSuggest())
+}
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"doctorrank_go/middlewares"
+	"github.com/gin-gonic/gin"
+)
+
+func SessionRoute(router *gin.Engine) {
+	router.GET("/sessions", middlewares.Authentication(), controllers.AllSessions())
+	router.DELETE("/sessions/:sessionId", middlewares.Authentication(), controllers.RevokeSession())
+	router.DELETE("/sessions", middlewares.Authentication(), controllers.RevokeOtherSessions())
+}
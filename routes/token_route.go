@@ -0,0 +1,10 @@
+package routes
+
+import (
+	"doctorrank_go/controllers"
+	"github.com/gin-gonic/gin"
+)
+
+func TokenRoute(router *gin.Engine) {
+	router.GET("/.well-known/jwks.json", controllers.Jwks())
+}
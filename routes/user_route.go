@@ -12,15 +12,33 @@ func UserRoute(router *gin.Engine) {
 
 	router.POST("/register", controllers.Register())
 	router.POST("/activation", controllers.ActivateProfile())
+	router.POST("/activation/resend", controllers.ResendActivation())
+	router.GET("/activation/status", controllers.ActivationStatus())
 	router.POST("/login", controllers.Login())
+	router.POST("/login/mfa", controllers.LoginMfa())
+	router.POST("/login/magic-link", controllers.MagicLinkLogin())
+	router.POST("/login/magic-link/verify", controllers.VerifyMagicLink())
 	router.POST("/logout", controllers.Logout())
+	router.POST("/unlock", controllers.UnlockAccount())
 	router.GET("/refresh", controllers.Refresh())
-	router.PUT("/role", middlewares.Authentication(), controllers.ChangeUserRole())
 	router.PUT("/update", middlewares.Authentication(), controllers.UpdateUser())
 	router.PUT("/password", middlewares.Authentication(), controllers.ChangePassword())
+	router.POST("/email-change", middlewares.Authentication(), controllers.RequestEmailChange())
+	router.POST("/email-change/confirm", controllers.ConfirmEmailChange())
 	router.GET("/password-reset", controllers.PasswordResetEmail())
 	router.POST("/password-reset", controllers.ResetPassword())
+	router.POST("/mfa/setup", middlewares.Authentication(), controllers.SetupMfa())
+	router.POST("/mfa/enable", middlewares.Authentication(), controllers.EnableMfa())
+	router.POST("/mfa/disable", middlewares.Authentication(), controllers.DisableMfa())
+	router.POST("/mfa/recovery-codes", middlewares.Authentication(), controllers.RegenerateRecoveryCodes())
+	router.DELETE("/me", middlewares.Authentication(), controllers.DeleteAccount())
+	router.POST("/me/export", middlewares.Authentication(), controllers.RequestDataExport())
+	router.GET("/me/export/:exportId", controllers.DownloadDataExport())
 	router.PUT("/avatar", middlewares.Authentication(), controllers.UploadAvatar())
+	router.PUT("/privacy", middlewares.Authentication(), controllers.UpdatePrivacy())
+	router.PUT("/username", middlewares.Authentication(), controllers.ChangeUsername())
+	router.GET("/username/availability", controllers.UsernameAvailability())
+	router.GET("/users/:username", controllers.PublicProfile())
 	router.Static("/user/avatar", path+"/user/avatar/")
 	router.Static("/user/thumbnail", path+"/user/thumbnail/")
 }